@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	appcli "cc/wcx/internal/cli"
 	"cc/wcx/internal/wc"
@@ -13,8 +18,22 @@ var version = "dev"
 
 var errPartialFailure = errors.New("one or more inputs failed")
 
+// interruptedError reports a run cut short by a signal. The process exits with
+// the shell convention of 128 plus the signal number.
+type interruptedError struct {
+	signal syscall.Signal
+}
+
+func (e interruptedError) Error() string {
+	return "interrupted by " + e.signal.String()
+}
+
 func main() {
 	if err := run(os.Args[1:]); err != nil {
+		var interrupted interruptedError
+		if errors.As(err, &interrupted) {
+			os.Exit(128 + int(interrupted.signal))
+		}
 		if !errors.Is(err, errPartialFailure) {
 			_, _ = fmt.Fprintln(os.Stderr, err)
 		}
@@ -23,7 +42,7 @@ func main() {
 }
 
 func run(args []string) error {
-	config, err := appcli.Parse(args)
+	config, err := appcli.Load(args, appcli.DefaultEnvironment())
 	if err != nil {
 		return err
 	}
@@ -38,41 +57,148 @@ func run(args []string) error {
 		return nil
 	}
 
-	inputs, err := wc.ResolveInputs(config.Args, config.Files0From)
+	if config.PrintConfig {
+		fmt.Print(appcli.FormatSettings(config))
+		return nil
+	}
+
+	if config.Completion != "" {
+		script, err := appcli.CompletionScript(config.Completion)
+		if err != nil {
+			return err
+		}
+		fmt.Print(script)
+		return nil
+	}
+
+	// --allow-exec trusts the names to count: exec:// runs commands, and
+	// names from --files0-from are opened through their scheme too.
+	if config.AllowExec {
+		if err := wc.RegisterOpener("exec", wc.OpenCommand); err != nil {
+			return err
+		}
+	}
+	inputs, err := wc.ResolveInputsOptions(config.Args, wc.ResolveOptions{Files0From: config.Files0From, Files0Schemes: config.AllowExec})
 	if err != nil {
 		return err
 	}
+	inputs = wc.ExcludeInputs(inputs, config.Exclude)
+
+	if !config.AllowExec && config.Files0From == "" {
+		for _, input := range inputs {
+			if isCommandOperand(input) {
+				return fmt.Errorf("%s: exec:// operands require --allow-exec", input.DisplayName)
+			}
+		}
+	}
 
 	options := wc.RunOptions{
-		Selection: config.Selection,
-		TotalMode: config.TotalMode,
-		JSON:      config.JSON,
+		Selection:    config.Selection,
+		TotalMode:    config.TotalMode,
+		Format:       config.Format,
+		IO:           config.IO,
+		Jobs:         config.Jobs,
+		InputTimeout: config.InputTimeout,
+		Binary:       config.Binary,
+		RequireEOL:   config.RequireEOL,
+		RequireUTF8:  config.RequireUTF8,
+		Dedupe:       config.Dedupe,
+		Slice:        config.Slice,
 	}
 
-	runResult := wc.Run(inputs, options)
+	if config.Cache != "" {
+		cache, err := wc.OpenCache(config.Cache)
+		if err != nil {
+			return fmt.Errorf("%s: %w", config.Cache, err)
+		}
+		options.Cache = cache
+	}
 
-	for _, row := range runResult.Rows {
+	// Rows go straight to stdout as they complete, so long runs show
+	// progress; errors and failed checks are reported on stderr in the same
+	// order.
+	options.OnRow = func(row wc.OutputRow) {
+		name := row.Name
+		if name == "" {
+			name = "-"
+		}
 		if row.Error != nil {
-			name := row.Name
-			if name == "" {
-				name = "-"
-			}
 			_, _ = fmt.Fprintf(os.Stderr, "wcx: %s: %v\n", name, row.Error)
 		}
+		if row.Status.Failed {
+			_, _ = fmt.Fprintf(os.Stderr, "wcx: %s: %s\n", name, row.Status.Reason)
+		}
 	}
 
-	output, err := wc.Render(runResult, options)
+	ctx, stopSignals := cancelOnSignal()
+	runResult, err := wc.RunTo(ctx, os.Stdout, inputs, options)
+	received := stopSignals()
 	if err != nil {
 		return err
 	}
 
-	if output != "" {
-		fmt.Println(output)
+	// Even a partial run leaves valid entries for the files it finished, and
+	// a cache that cannot be written only costs speed on the next run.
+	if options.Cache != nil {
+		if err := options.Cache.Save(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "wcx: %s: unable to save cache: %v\n", config.Cache, err)
+		}
+		if config.CacheStats {
+			stats := options.Cache.Stats()
+			_, _ = fmt.Fprintf(os.Stderr, "wcx: cache: %d hits, %d misses\n", stats.Hits, stats.Misses)
+		}
+	}
+
+	if runResult.Partial {
+		_, _ = fmt.Fprintln(os.Stderr, "wcx: interrupted: counts are partial")
+		if sig, ok := received.(syscall.Signal); ok {
+			return interruptedError{signal: sig}
+		}
+		return interruptedError{signal: syscall.SIGINT}
 	}
 
-	if runResult.HadErrors {
+	if runResult.HadErrors || runResult.Failed > 0 {
 		return errPartialFailure
 	}
 
 	return nil
 }
+
+// cancelOnSignal returns a context cancelled by the first SIGINT or SIGTERM,
+// and a stop function reporting which signal arrived, if any. After the first
+// signal the default handling is restored, so a second Ctrl-C still kills a
+// run blocked on a read that cannot be interrupted.
+func cancelOnSignal() (context.Context, func() os.Signal) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	var received os.Signal
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case received = <-signals:
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() os.Signal {
+		signal.Stop(signals)
+		cancel()
+		<-finished
+		return received
+	}
+}
+
+// isCommandOperand reports an exec:// operand given without --allow-exec. A
+// file of that name is still counted.
+func isCommandOperand(input wc.InputSource) bool {
+	if input.Scheme != "" || input.FS != nil || !strings.HasPrefix(strings.ToLower(input.Path), "exec://") {
+		return false
+	}
+	_, err := os.Stat(input.Path)
+	return errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// CompletionScript renders a completion script for shell from the option
+// table, so every option Parse accepts is offered.
+func CompletionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion(), nil
+	case "zsh":
+		return zshCompletion(), nil
+	case "fish":
+		return fishCompletion(), nil
+	default:
+		return "", fmt.Errorf("unsupported shell for completion: %s", shell)
+	}
+}
+
+// bashCompletion handles both "--opt=value" and "--opt value". Bash splits
+// words on '=' by default, so the option name may sit one or two words back.
+func bashCompletion() string {
+	var words []string
+	var valueCases strings.Builder
+	for _, opt := range options {
+		if opt.short != 0 {
+			words = append(words, "-"+string(opt.short))
+		}
+		name := "--" + opt.long
+		if opt.value != "" {
+			name += "="
+		}
+		words = append(words, name)
+
+		switch {
+		case len(opt.choices) > 0:
+			fmt.Fprintf(&valueCases, "        --%s)\n            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n            return\n            ;;\n", opt.long, strings.Join(opt.choices, " "))
+		case opt.file:
+			fmt.Fprintf(&valueCases, "        --%s)\n            COMPREPLY=($(compgen -f -- \"$cur\"))\n            return\n            ;;\n", opt.long)
+		}
+	}
+
+	return `# bash completion for wcx
+_wcx() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local opt="${COMP_WORDS[COMP_CWORD-1]}"
+    if [[ "$cur" == "=" ]]; then
+        cur=""
+    elif [[ "$opt" == "=" ]]; then
+        opt="${COMP_WORDS[COMP_CWORD-2]}"
+    fi
+
+    case "$opt" in
+` + valueCases.String() + `    esac
+
+    if [[ "$cur" == -* ]]; then
+        compopt -o nospace 2>/dev/null
+        COMPREPLY=($(compgen -W "` + strings.Join(words, " ") + `" -- "$cur"))
+        if [[ ${#COMPREPLY[@]} -eq 1 && "${COMPREPLY[0]}" != *= ]]; then
+            compopt +o nospace 2>/dev/null
+        fi
+        return
+    fi
+
+    COMPREPLY=($(compgen -f -- "$cur"))
+}
+complete -o filenames -F _wcx wcx
+`
+}
+
+func zshCompletion() string {
+	var builder strings.Builder
+	builder.WriteString("#compdef wcx\n\n_arguments -s -S \\\n")
+	for _, opt := range options {
+		usage := zshEscape(opt.usage)
+		action := ""
+		switch {
+		case len(opt.choices) > 0:
+			action = ":" + strings.ToLower(opt.value) + ":(" + strings.Join(opt.choices, " ") + ")"
+		case opt.file:
+			action = ":file:_files"
+		case opt.value != "":
+			action = ":" + strings.ToLower(opt.value) + ":"
+		}
+
+		long := "--" + opt.long
+		if opt.value != "" {
+			long += "="
+		}
+
+		if opt.short != 0 {
+			short := "-" + string(opt.short)
+			fmt.Fprintf(&builder, "  '(%s %s)'{%s,%s}'[%s]%s' \\\n", short, "--"+opt.long, short, long, usage, action)
+			continue
+		}
+		fmt.Fprintf(&builder, "  '%s[%s]%s' \\\n", long, usage, action)
+	}
+	builder.WriteString("  '*:file:_files'\n")
+
+	return builder.String()
+}
+
+func fishCompletion() string {
+	var builder strings.Builder
+	builder.WriteString("# fish completion for wcx\n")
+	for _, opt := range options {
+		builder.WriteString("complete -c wcx")
+		if opt.short != 0 {
+			fmt.Fprintf(&builder, " -s %c", opt.short)
+		}
+		fmt.Fprintf(&builder, " -l %s", opt.long)
+		switch {
+		case len(opt.choices) > 0:
+			fmt.Fprintf(&builder, " -x -a '%s'", strings.Join(opt.choices, " "))
+		case opt.file:
+			builder.WriteString(" -r -F")
+		case opt.value != "":
+			builder.WriteString(" -x")
+		}
+		fmt.Fprintf(&builder, " -d %s\n", fishQuote(opt.usage))
+	}
+
+	return builder.String()
+}
+
+// zshEscape protects characters that _arguments treats specially inside a
+// single-quoted "[description]" spec.
+func zshEscape(value string) string {
+	replacer := strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`)
+	return replacer.Replace(value)
+}
+
+func fishQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + replacer.Replace(value) + "'"
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompletionScriptCoversOptionTable(t *testing.T) {
+	for _, shell := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			script, err := CompletionScript(shell)
+			if err != nil {
+				t.Fatalf("CompletionScript failed: %v", err)
+			}
+
+			for _, opt := range options {
+				if !strings.Contains(script, opt.long) {
+					t.Fatalf("%s script is missing --%s", shell, opt.long)
+				}
+				for _, choice := range opt.choices {
+					if !strings.Contains(script, choice) {
+						t.Fatalf("%s script is missing value %q for --%s", shell, choice, opt.long)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompletionScriptRejectsUnknownShell(t *testing.T) {
+	if _, err := CompletionScript("tcsh"); err == nil {
+		t.Fatalf("expected error for unsupported shell")
+	}
+}
+
+func TestHelpTextListsEveryOption(t *testing.T) {
+	help := HelpText()
+	for _, opt := range options {
+		if !strings.Contains(help, optionLabel(opt)) {
+			t.Fatalf("help text is missing %q", optionLabel(opt))
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	projectConfigName  = ".wcx.toml"
+	optionsEnvName     = "WCX_OPTIONS"
+	profileTablePrefix = "profile."
+)
+
+// Environment supplies the process state Load consults. Tests substitute it
+// to avoid depending on the real home directory or working directory.
+type Environment struct {
+	Getenv  func(string) string
+	WorkDir string
+}
+
+func DefaultEnvironment() Environment {
+	workDir, err := os.Getwd()
+	if err != nil {
+		workDir = ""
+	}
+
+	return Environment{Getenv: os.Getenv, WorkDir: workDir}
+}
+
+// Load parses args on top of the defaults found in config files and the
+// WCX_OPTIONS environment variable. Precedence from lowest to highest is:
+// built-in defaults, the user config file, the nearest project .wcx.toml,
+// WCX_OPTIONS, and finally args. Inside a file, the selected [profile.NAME]
+// block overrides that file's top-level keys.
+func Load(args []string, env Environment) (Config, error) {
+	cliAssignments, operands, err := tokenize(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	envAssignments, err := environmentAssignments(env.Getenv(optionsEnvName))
+	if err != nil {
+		return Config{}, err
+	}
+
+	profile := ""
+	for _, assignments := range [][]assignment{envAssignments, cliAssignments} {
+		for _, a := range assignments {
+			if a.opt.long == "profile" {
+				profile = a.value
+			}
+		}
+	}
+
+	var layers []layer
+	profileFound := false
+	for _, file := range configFiles(env) {
+		fileLayers, hasProfile, err := loadConfigFile(file, profile)
+		if err != nil {
+			return Config{}, err
+		}
+		profileFound = profileFound || hasProfile
+		layers = append(layers, fileLayers...)
+	}
+
+	if profile != "" && !profileFound {
+		return Config{}, fmt.Errorf("unknown profile: %s", profile)
+	}
+
+	layers = append(layers,
+		layer{source: optionsEnvName, assignments: envAssignments},
+		layer{source: sourceCommandLine, assignments: cliAssignments},
+	)
+
+	return resolve(layers, operands)
+}
+
+// configFile is a config file to load. Project files come with the checkout
+// wcx runs in, so they are not trusted with userOnly options.
+type configFile struct {
+	path    string
+	project bool
+}
+
+// configFiles lists existing config files from lowest to highest precedence.
+func configFiles(env Environment) []configFile {
+	var files []configFile
+
+	configHome := env.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home := env.Getenv("HOME"); home != "" {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		userPath := filepath.Join(configHome, "wcx", "config.toml")
+		if isRegularFile(userPath) {
+			files = append(files, configFile{path: userPath})
+		}
+	}
+
+	if projectPath, ok := findProjectConfig(env.WorkDir); ok {
+		files = append(files, configFile{path: projectPath, project: true})
+	}
+
+	return files
+}
+
+// findProjectConfig walks from dir towards the filesystem root and returns the
+// first .wcx.toml it finds.
+func findProjectConfig(dir string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+
+	for {
+		candidate := filepath.Join(dir, projectConfigName)
+		if isRegularFile(candidate) {
+			return candidate, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// loadConfigFile returns the top-level layer of file followed by the layer for
+// profile, if the file defines it.
+func loadConfigFile(file configFile, profile string) ([]layer, bool, error) {
+	path := file.path
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	entries, tables, err := parseTOML(string(raw))
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	base := layer{source: path}
+	profileLayer := layer{source: fmt.Sprintf("%s [%s%s]", path, profileTablePrefix, profile)}
+	hasProfile := profile != "" && containsString(tables, profileTablePrefix+profile)
+
+	for _, entry := range entries {
+		var target *layer
+		switch {
+		case entry.table == "":
+			target = &base
+		case strings.HasPrefix(entry.table, profileTablePrefix):
+			if strings.TrimPrefix(entry.table, profileTablePrefix) != profile {
+				continue
+			}
+			target = &profileLayer
+		default:
+			return nil, false, fmt.Errorf("%s: line %d: unknown table [%s]", path, entry.line, entry.table)
+		}
+
+		opt, ok := lookupLong(entry.key)
+		if !ok || opt.show == nil {
+			return nil, false, fmt.Errorf("%s: line %d: unknown setting %q", path, entry.line, entry.key)
+		}
+		if opt.userOnly && file.project {
+			return nil, false, fmt.Errorf("%s: line %d: %s can only be set on the command line or in the user config", path, entry.line, entry.key)
+		}
+		if entry.array && !opt.repeatable {
+			return nil, false, fmt.Errorf("%s: line %d: %s does not accept a list", path, entry.line, entry.key)
+		}
+
+		for _, value := range entry.values {
+			target.assignments = append(target.assignments, assignment{opt: opt, value: value})
+		}
+	}
+
+	return []layer{base, profileLayer}, hasProfile, nil
+}
+
+// environmentAssignments parses WCX_OPTIONS with shell-like quoting. Operands
+// are rejected so the variable cannot silently add inputs to every run.
+func environmentAssignments(value string) ([]assignment, error) {
+	words, err := splitShellWords(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", optionsEnvName, err)
+	}
+
+	assignments, operands, err := tokenize(words)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", optionsEnvName, err)
+	}
+	if len(operands) > 0 {
+		return nil, fmt.Errorf("%s: file operands are not allowed: %s", optionsEnvName, operands[0])
+	}
+
+	for _, a := range assignments {
+		if a.opt.show == nil && a.opt.long != "profile" {
+			return nil, fmt.Errorf("%s: --%s is not allowed", optionsEnvName, a.opt.long)
+		}
+	}
+
+	return assignments, nil
+}
+
+// splitShellWords splits value on whitespace, honouring single quotes, double
+// quotes, and backslash escapes the way a POSIX shell would.
+func splitShellWords(value string) ([]string, error) {
+	var words []string
+	var current strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]) {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			}
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+
+	return words, nil
+}
+
+// FormatSettings renders the effective settings as TOML, annotated with the
+// layer each value came from.
+func FormatSettings(config Config) string {
+	var builder strings.Builder
+	if config.Profile != "" {
+		fmt.Fprintf(&builder, "# profile: %s\n", config.Profile)
+	}
+
+	width := 0
+	lines := make([]string, 0, len(config.Settings))
+	for _, setting := range config.Settings {
+		line := setting.Name + " = " + setting.Value
+		width = max(width, len(line))
+		lines = append(lines, line)
+	}
+
+	for i, setting := range config.Settings {
+		fmt.Fprintf(&builder, "%-*s  # %s\n", width, lines[i], setting.Source)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,263 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cc/wcx/internal/wc"
+)
+
+func writeConfig(t *testing.T, path string, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("unable to create config dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("unable to write config: %v", err)
+	}
+}
+
+func testEnvironment(workDir string, vars map[string]string) Environment {
+	return Environment{
+		Getenv:  func(name string) string { return vars[name] },
+		WorkDir: workDir,
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tmp := t.TempDir()
+	configHome := filepath.Join(tmp, "xdg")
+	project := filepath.Join(tmp, "repo")
+	workDir := filepath.Join(project, "nested", "dir")
+	if err := os.MkdirAll(workDir, 0o755); err != nil {
+		t.Fatalf("unable to create work dir: %v", err)
+	}
+
+	writeConfig(t, filepath.Join(configHome, "wcx", "config.toml"), `
+json = true
+total = "never"
+exclude = ["*.png"]
+
+[profile.ci]
+total = "always"
+`)
+	writeConfig(t, filepath.Join(project, ".wcx.toml"), `
+words = true # project default
+exclude = [
+  "vendor/*",
+]
+`)
+
+	tests := []struct {
+		name  string
+		args  []string
+		vars  map[string]string
+		check func(*testing.T, Config)
+	}{
+		{
+			name: "files merge below the command line",
+			args: []string{"a.txt"},
+			check: func(t *testing.T, config Config) {
+				if !config.JSON {
+					t.Fatalf("expected json from user config")
+				}
+				if config.TotalMode != wc.TotalNever {
+					t.Fatalf("total mode mismatch: got %q", config.TotalMode)
+				}
+				if want := wc.SelectionFromFlags(false, true, false, false, false); !config.Selection.Equal(want) {
+					t.Fatalf("selection mismatch: got %+v want %+v", config.Selection, want)
+				}
+				if want := []string{"*.png", "vendor/*"}; !reflect.DeepEqual(config.Exclude, want) {
+					t.Fatalf("exclude mismatch: got %#v want %#v", config.Exclude, want)
+				}
+				for _, setting := range config.Settings {
+					if setting.Name == "format" && setting.Source != filepath.Join(configHome, "wcx", "config.toml") {
+						t.Fatalf("format set by json has source %q", setting.Source)
+					}
+				}
+			},
+		},
+		{
+			name: "command line count flags replace config counts",
+			args: []string{"-l", "--json=false"},
+			check: func(t *testing.T, config Config) {
+				if config.JSON {
+					t.Fatalf("expected --json=false to override config")
+				}
+				if want := wc.SelectionFromFlags(true, false, false, false, false); !config.Selection.Equal(want) {
+					t.Fatalf("selection mismatch: got %+v want %+v", config.Selection, want)
+				}
+			},
+		},
+		{
+			name: "environment sits between files and command line",
+			args: []string{"--total=only"},
+			vars: map[string]string{optionsEnvName: "--total=auto -c"},
+			check: func(t *testing.T, config Config) {
+				if config.TotalMode != wc.TotalOnly {
+					t.Fatalf("total mode mismatch: got %q", config.TotalMode)
+				}
+				if want := wc.SelectionFromFlags(false, false, false, true, false); !config.Selection.Equal(want) {
+					t.Fatalf("selection mismatch: got %+v want %+v", config.Selection, want)
+				}
+			},
+		},
+		{
+			name: "profile overrides top-level keys",
+			args: []string{"--profile", "ci"},
+			check: func(t *testing.T, config Config) {
+				if config.TotalMode != wc.TotalAlways {
+					t.Fatalf("total mode mismatch: got %q", config.TotalMode)
+				}
+				for _, setting := range config.Settings {
+					if setting.Name == "total" && setting.Source != filepath.Join(configHome, "wcx", "config.toml")+" [profile.ci]" {
+						t.Fatalf("unexpected total source: %q", setting.Source)
+					}
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vars := map[string]string{"XDG_CONFIG_HOME": configHome}
+			for name, value := range test.vars {
+				vars[name] = value
+			}
+
+			config, err := Load(test.args, testEnvironment(workDir, vars))
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			test.check(t, config)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tmp := t.TempDir()
+	writeConfig(t, filepath.Join(tmp, ".wcx.toml"), "colour = true\n")
+
+	tests := []struct {
+		name    string
+		workDir string
+		vars    map[string]string
+		args    []string
+	}{
+		{name: "unknown config key", workDir: tmp},
+		{name: "unknown profile", args: []string{"--profile=missing"}},
+		{name: "operands in WCX_OPTIONS", vars: map[string]string{optionsEnvName: "file.txt"}},
+		{name: "unterminated quote in WCX_OPTIONS", vars: map[string]string{optionsEnvName: `--exclude="*.txt`}},
+		{name: "invalid boolean", args: []string{"--json=maybe"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Load(test.args, testEnvironment(test.workDir, test.vars)); err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestFormatSettingsLoadsBack(t *testing.T) {
+	tmp := t.TempDir()
+	configHome := filepath.Join(tmp, "xdg")
+	vars := map[string]string{"XDG_CONFIG_HOME": configHome}
+
+	config, err := Load([]string{"-z", "--where-line=\ta\x01\u00e9\\\""}, testEnvironment(tmp, vars))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	settings := FormatSettings(config)
+	if strings.Contains(settings, `\x`) || strings.Contains(settings, `\a`) {
+		t.Fatalf("settings use escapes TOML does not define:\n%s", settings)
+	}
+
+	writeConfig(t, filepath.Join(configHome, "wcx", "config.toml"), settings)
+	loaded, err := Load(nil, testEnvironment(tmp, vars))
+	if err != nil {
+		t.Fatalf("loading printed settings failed: %v\n%s", err, settings)
+	}
+	if loaded.RecordDelimiter != "\x00" || loaded.WhereLine != config.WhereLine {
+		t.Fatalf("settings did not round-trip: got %q and %q want %q and %q", loaded.RecordDelimiter, loaded.WhereLine, "\x00", config.WhereLine)
+	}
+}
+
+func TestTOMLQuote(t *testing.T) {
+	tests := map[string]string{
+		"plain":      `"plain"`,
+		"\x00":       `"\u0000"`,
+		"a\tb\n":     `"a\tb\n"`,
+		"\a\x1b\x7f": `"\u0007\u001B\u007F"`,
+		`q"\`:        `"q\"\\"`,
+		"\u00e9":     `"é"`,
+	}
+	for value, want := range tests {
+		got := tomlQuote(value)
+		if got != want {
+			t.Fatalf("tomlQuote(%q) = %s, want %s", value, got, want)
+		}
+		if back, err := parseTOMLString(got); err != nil || back != value {
+			t.Fatalf("parseTOMLString(%s) = %q, %v", got, back, err)
+		}
+	}
+}
+
+func TestParseTOMLStringEscapes(t *testing.T) {
+	valid := map[string]string{
+		`"tab\there"`:        "tab\there",
+		`"\b\f\n\r\"\\"`:     "\b\f\n\r\"\\",
+		`"\u00e9\U0001F600"`: "\u00e9\U0001F600",
+		"\"raw\ttab\"":       "raw\ttab",
+	}
+	for value, want := range valid {
+		if got, err := parseTOMLString(value); err != nil || got != want {
+			t.Fatalf("parseTOMLString(%s) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{`"\x41"`, `"\a"`, `"\v"`, `"\101"`, `"\e"`, `"\u00"`, `"\uD800"`, `"\U00110000"`, `"trailing\"`, "\"raw\x01\"", `"a"b"`} {
+		if got, err := parseTOMLString(value); err == nil {
+			t.Fatalf("parseTOMLString(%s) = %q, want an error", value, got)
+		}
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	entries, tables, err := parseTOML(`
+# comment
+json = true
+jobs = 1_000
+name = 'lit#eral'
+list = ["a,b", "c"] # trailing
+[profile."ci"]
+`)
+	if err != nil {
+		t.Fatalf("parseTOML failed: %v", err)
+	}
+
+	got := make(map[string][]string)
+	for _, entry := range entries {
+		got[entry.key] = entry.values
+	}
+	want := map[string][]string{
+		"json": {"true"},
+		"jobs": {"1000"},
+		"name": {"lit#eral"},
+		"list": {"a,b", "c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("entries mismatch: got %#v want %#v", got, want)
+	}
+	if !reflect.DeepEqual(tables, []string{"profile.ci"}) {
+		t.Fatalf("tables mismatch: got %#v", tables)
+	}
+
+	if _, _, err := parseTOML("when = 1979-05-27\n"); err == nil {
+		t.Fatalf("expected error for unsupported value")
+	}
+}
@@ -2,7 +2,11 @@ package cli
 
 import (
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"cc/wcx/internal/wc"
 )
@@ -11,115 +15,734 @@ type Config struct {
 	Selection  wc.CountSelection
 	TotalMode  wc.TotalMode
 	Files0From string
-	JSON       bool
-	Help       bool
-	Version    bool
-	Args       []string
+	Exclude    []string
+	// Hash names the content hash column; empty prints none.
+	Hash   string
+	Dedupe bool
+	Binary wc.BinaryPolicy
+	// EOLStats adds line ending columns; RequireEOL fails other endings.
+	EOLStats   bool
+	RequireEOL wc.LineEnding
+	// CheckEncoding adds a UTF-8 validity report; RequireUTF8 fails inputs
+	// that are not valid UTF-8.
+	CheckEncoding bool
+	RequireUTF8   bool
+	// Breakdown counts characters by script or category; empty disables it.
+	Breakdown wc.Breakdown
+	// WhereLine and WhereNotLine restrict the counts to matching and
+	// non-matching lines; empty disables them.
+	WhereLine    string
+	WhereNotLine string
+	// RecordDelimiter ends lines in place of the newline; empty means a
+	// newline.
+	RecordDelimiter string
+	// UnicodeNewlines ends lines at any Unicode line break for -l and -L,
+	// unless a record delimiter is set.
+	UnicodeNewlines bool
+	// Slice is set by --bytes-range, --lines-range, --head, and --tail; the
+	// last one given wins.
+	Slice wc.Slice
+	// ListFindings lists the lines flagged by metrics.
+	ListFindings bool
+	// Format names the output formatter; JSON reports whether it is "json".
+	Format string
+	JSON   bool
+	IO     wc.IOMode
+	Jobs   int
+	// InputTimeout bounds URL and command inputs.
+	InputTimeout time.Duration
+	AllowExec    bool
+	// Cache is the path of the count cache; empty disables it.
+	Cache       string
+	CacheStats  bool
+	Help        bool
+	Version     bool
+	Completion  string
+	Profile     string
+	PrintConfig bool
+	Args        []string
+	// Settings records the effective value of every configurable option and
+	// the layer it came from, for --print-config.
+	Settings []Setting
 }
 
+// Setting is one configurable option as resolved across all layers.
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+const (
+	sourceDefault     = "default"
+	sourceCommandLine = "command line"
+)
+
 type parseFlags struct {
 	lines         bool
 	words         bool
 	chars         bool
 	bytes         bool
 	maxLineLength bool
+	metrics       []wc.Metric
+}
+
+type parser struct {
+	config  Config
+	flags   parseFlags
+	sources map[string]string
+	// source names the layer being applied.
+	source string
+}
+
+// setSources records the current layer as the source of names too, for
+// options that set the same value as others.
+func (p *parser) setSources(names ...string) {
+	for _, name := range names {
+		p.sources[name] = p.source
+	}
+}
+
+// option describes one command-line option. Parse, HelpText, the shell
+// completion generators, and the config file loader all read the same table so
+// they cannot drift apart.
+type option struct {
+	short rune
+	long  string
+	// value names the option argument in help output; options without one
+	// are boolean flags.
+	value string
+	// choices lists the accepted values offered by shell completion.
+	choices []string
+	// file marks option arguments that name a file.
+	file bool
+	// count marks the options that together form the count selection.
+	count bool
+	// repeatable options accumulate values instead of replacing them.
+	repeatable bool
+	usage      string
+	apply      func(p *parser, value string) error
+	// show renders the effective value as a TOML literal. Options without it
+	// cannot be set from config files or WCX_OPTIONS.
+	show func(c Config) string
+	// userOnly options name files wcx writes, so they are refused in project
+	// config files, which come with whatever checkout wcx runs in.
+	userOnly bool
+}
+
+var options = []option{
+	{short: 'c', long: "bytes", count: true, usage: "print the byte counts", apply: func(p *parser, value string) error {
+		p.flags.bytes = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.Selection.Bytes) }},
+	{short: 'l', long: "lines", count: true, usage: "print the newline counts", apply: func(p *parser, value string) error {
+		p.flags.lines = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.Selection.Lines) }},
+	{short: 'w', long: "words", count: true, usage: "print the word counts", apply: func(p *parser, value string) error {
+		p.flags.words = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.Selection.Words) }},
+	{short: 'm', long: "chars", count: true, usage: "print the character counts", apply: func(p *parser, value string) error {
+		p.flags.chars = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.Selection.Chars) }},
+	{short: 'L', long: "max-line-length", count: true, usage: "print the maximum display width", apply: func(p *parser, value string) error {
+		p.flags.maxLineLength = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.Selection.MaxLineLength) }},
+	{long: "metric", value: "NAME", count: true, repeatable: true, usage: "print the bundled or registered metric NAME", apply: func(p *parser, value string) error {
+		metric, ok := wc.LookupMetric(value)
+		if !ok {
+			return fmt.Errorf("invalid value for --metric: no metric named %q is registered", value)
+		}
+		for _, selected := range p.flags.metrics {
+			if selected.Name() == value {
+				return nil
+			}
+		}
+		p.flags.metrics = append(p.flags.metrics, metric)
+		return nil
+	}, show: func(c Config) string { return tomlStringArray(registeredMetricNames(c.Selection.Extra)) }},
+	{long: "count-matches", value: "NAME=REGEX", count: true, repeatable: true, usage: "print a column NAME counting the non-overlapping matches of REGEX", apply: func(p *parser, value string) error {
+		return p.applyMatch("count-matches", wc.MatchOccurrences, value)
+	}, show: func(c Config) string { return tomlStringArray(matchSpecs(c.Selection.Extra, wc.MatchOccurrences)) }},
+	{long: "count-matching-lines", value: "NAME=REGEX", count: true, repeatable: true, usage: "print a column NAME counting the lines REGEX matches, like grep -c", apply: func(p *parser, value string) error {
+		return p.applyMatch("count-matching-lines", wc.MatchLines, value)
+	}, show: func(c Config) string { return tomlStringArray(matchSpecs(c.Selection.Extra, wc.MatchLines)) }},
+	{long: "whitespace", count: true, usage: "print the whitespace metrics: trailing whitespace, tab, space, and mixed indentation, and maximum indentation", apply: func(p *parser, value string) error {
+		kept := p.flags.metrics[:0:0]
+		for _, selected := range p.flags.metrics {
+			if !isWhitespaceMetric(selected) {
+				kept = append(kept, selected)
+			}
+		}
+		if value == "true" {
+			kept = append(kept, wc.WhitespaceMetrics()...)
+		}
+		p.flags.metrics = kept
+		return nil
+	}, show: func(c Config) string {
+		selected := 0
+		for _, metric := range c.Selection.Extra {
+			if isWhitespaceMetric(metric) {
+				selected++
+			}
+		}
+		return strconv.FormatBool(selected == len(wc.WhitespaceMetrics()))
+	}},
+	{long: "list-findings", usage: "list the lines flagged by the selected metrics as FILE:LINE: METRIC", apply: func(p *parser, value string) error {
+		p.config.ListFindings = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.ListFindings) }},
+	{long: "files0-from", value: "F", file: true, usage: "read input from NUL-terminated names in file F", apply: func(p *parser, value string) error {
+		p.config.Files0From = value
+		return nil
+	}, show: func(c Config) string { return tomlQuote(c.Files0From) }},
+	{long: "total", value: "WHEN", choices: totalModeNames(), usage: "WHEN to print total counts: " + strings.Join(totalModeNames(), ", "), apply: func(p *parser, value string) error {
+		mode, ok := wc.ParseTotalMode(value)
+		if !ok {
+			return fmt.Errorf("invalid value for --total: use auto, always, only, or never")
+		}
+		p.config.TotalMode = mode
+		return nil
+	}, show: func(c Config) string { return tomlQuote(string(c.TotalMode)) }},
+	{long: "exclude", value: "PATTERN", repeatable: true, usage: "skip file operands whose path or base name matches PATTERN", apply: func(p *parser, value string) error {
+		if _, err := filepath.Match(value, ""); err != nil {
+			return fmt.Errorf("invalid value for --exclude: %v", err)
+		}
+		p.config.Exclude = append(p.config.Exclude, value)
+		return nil
+	}, show: func(c Config) string { return tomlStringArray(c.Exclude) }},
+	{long: "hash", value: "NAME", choices: hashNames(), usage: "print a content hash of each file: " + strings.Join(hashNames(), ", "), apply: func(p *parser, value string) error {
+		if value == "none" {
+			p.config.Hash = ""
+			return nil
+		}
+		for _, name := range wc.HashNames() {
+			if value == name {
+				p.config.Hash = value
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid value for --hash: use one of %s", strings.Join(hashNames(), ", "))
+	}, show: func(c Config) string {
+		if c.Hash == "" {
+			return tomlQuote("none")
+		}
+		return tomlQuote(c.Hash)
+	}},
+	{long: "binary", value: "POLICY", choices: binaryPolicyNames(), usage: "count, skip, or report inputs that look binary: " + strings.Join(binaryPolicyNames(), ", "), apply: func(p *parser, value string) error {
+		policy, ok := wc.ParseBinaryPolicy(value)
+		if !ok {
+			return fmt.Errorf("invalid value for --binary: use one of %s", strings.Join(binaryPolicyNames(), ", "))
+		}
+		p.config.Binary = policy
+		return nil
+	}, show: func(c Config) string { return tomlQuote(string(c.Binary)) }},
+	{long: "eol-stats", usage: "print LF, CRLF, lone CR, mixed, and no-final-newline columns", apply: func(p *parser, value string) error {
+		p.config.EOLStats = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.EOLStats) }},
+	{long: "require-eol", value: "STYLE", choices: lineEndingNames(), usage: "fail inputs whose lines do not all end with STYLE: " + strings.Join(lineEndingNames(), ", "), apply: func(p *parser, value string) error {
+		if value == "none" {
+			p.config.RequireEOL = ""
+			return nil
+		}
+		style, ok := wc.ParseLineEnding(value)
+		if !ok {
+			return fmt.Errorf("invalid value for --require-eol: use one of %s", strings.Join(lineEndingNames(), ", "))
+		}
+		p.config.RequireEOL = style
+		return nil
+	}, show: func(c Config) string {
+		if c.RequireEOL == "" {
+			return tomlQuote("none")
+		}
+		return tomlQuote(string(c.RequireEOL))
+	}},
+	{long: "check-encoding", usage: "print invalid UTF-8 sequences, locate the first ones, and note byte order marks", apply: func(p *parser, value string) error {
+		p.config.CheckEncoding = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.CheckEncoding) }},
+	{long: "require-utf8", usage: "fail inputs with invalid UTF-8 or a UTF-16 or UTF-32 byte order mark", apply: func(p *parser, value string) error {
+		p.config.RequireUTF8 = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.RequireUTF8) }},
+	{long: "breakdown", value: "MODE", choices: breakdownNames(), usage: "print a table of characters per Unicode MODE: " + strings.Join(breakdownNames(), ", "), apply: func(p *parser, value string) error {
+		if value == "none" {
+			p.config.Breakdown = ""
+			return nil
+		}
+		mode, ok := wc.ParseBreakdown(value)
+		if !ok {
+			return fmt.Errorf("invalid value for --breakdown: use one of %s", strings.Join(breakdownNames(), ", "))
+		}
+		p.config.Breakdown = mode
+		return nil
+	}, show: func(c Config) string {
+		if c.Breakdown == "" {
+			return tomlQuote("none")
+		}
+		return tomlQuote(string(c.Breakdown))
+	}},
+	{long: "record-delimiter", value: "CHAR", usage: `end lines at CHAR instead of a newline: one ASCII character, or \0, \t, \xHH`, apply: func(p *parser, value string) error {
+		delimiter, ok := wc.ParseRecordDelimiter(value)
+		if !ok {
+			return fmt.Errorf(`invalid value for --record-delimiter: use one ASCII character, or an escape such as \0 or \x1e`)
+		}
+		if delimiter == "\n" {
+			delimiter = ""
+		}
+		p.config.RecordDelimiter = delimiter
+		p.setSources("null-data")
+		return nil
+	}, show: func(c Config) string {
+		if c.RecordDelimiter == "" {
+			return tomlQuote("\n")
+		}
+		return tomlQuote(c.RecordDelimiter)
+	}},
+	{short: 'z', long: "null-data", usage: "end lines at NUL bytes instead of newlines; same as --record-delimiter='\\0'", apply: func(p *parser, value string) error {
+		if value == "true" {
+			p.config.RecordDelimiter = "\x00"
+		} else if p.config.RecordDelimiter == "\x00" {
+			p.config.RecordDelimiter = ""
+		}
+		p.setSources("record-delimiter")
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.RecordDelimiter == "\x00") }},
+	{long: "unicode-newlines", usage: "end lines for -l and -L at any Unicode line break: LF, CR, CRLF, VT, FF, NEL, LS, PS", apply: func(p *parser, value string) error {
+		p.config.UnicodeNewlines = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.UnicodeNewlines) }},
+	{long: "where-line", value: "REGEX", usage: "count only the lines REGEX matches", apply: func(p *parser, value string) error {
+		if _, err := regexp.Compile(value); err != nil {
+			return fmt.Errorf("invalid value for --where-line: %v", err)
+		}
+		p.config.WhereLine = value
+		return nil
+	}, show: func(c Config) string { return tomlQuote(c.WhereLine) }},
+	{long: "where-not-line", value: "REGEX", usage: "count only the lines REGEX does not match", apply: func(p *parser, value string) error {
+		if _, err := regexp.Compile(value); err != nil {
+			return fmt.Errorf("invalid value for --where-not-line: %v", err)
+		}
+		p.config.WhereNotLine = value
+		return nil
+	}, show: func(c Config) string { return tomlQuote(c.WhereNotLine) }},
+	{long: "bytes-range", value: "START:END", usage: "count only bytes START through END of each input, from 1; -N: counts the last N", apply: func(p *parser, value string) error {
+		return p.applySlice("bytes-range", wc.SliceBytes, value)
+	}, show: func(c Config) string { return showSlice(c.Slice, wc.SliceBytes) }},
+	{long: "lines-range", value: "N:M", usage: "count only lines N through M of each input, from 1; -N: counts the last N", apply: func(p *parser, value string) error {
+		return p.applySlice("lines-range", wc.SliceLines, value)
+	}, show: func(c Config) string { return showSlice(c.Slice, wc.SliceLines) }},
+	{long: "head", value: "N", usage: "count only the first N lines of each input; same as --lines-range=:N", apply: func(p *parser, value string) error {
+		p.setSources(sliceOptions...)
+		if value == "none" {
+			p.config.Slice = wc.Slice{}
+			return nil
+		}
+		lines, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || lines < 0 {
+			return fmt.Errorf("invalid value for --head: use a non-negative integer")
+		}
+		p.config.Slice = wc.Slice{Unit: wc.SliceLines, End: lines}
+		if lines == 0 {
+			// The first 0 lines are the last 0.
+			p.config.Slice = wc.Slice{Unit: wc.SliceLines, Last: true}
+		}
+		return nil
+	}, show: func(c Config) string {
+		if c.Slice.Unit != wc.SliceLines || c.Slice.Last || c.Slice.Start != 0 || c.Slice.End == 0 {
+			return tomlQuote("none")
+		}
+		return strconv.FormatInt(c.Slice.End, 10)
+	}},
+	{long: "tail", value: "N", usage: "count only the last N lines of each input; same as --lines-range=-N:", apply: func(p *parser, value string) error {
+		p.setSources(sliceOptions...)
+		if value == "none" {
+			p.config.Slice = wc.Slice{}
+			return nil
+		}
+		lines, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || lines < 0 {
+			return fmt.Errorf("invalid value for --tail: use a non-negative integer")
+		}
+		p.config.Slice = wc.Slice{Unit: wc.SliceLines, Start: lines, Last: true}
+		return nil
+	}, show: func(c Config) string {
+		if c.Slice.Unit != wc.SliceLines || !c.Slice.Last {
+			return tomlQuote("none")
+		}
+		return strconv.FormatInt(c.Slice.Start, 10)
+	}},
+	{long: "dedupe", usage: "count files with identical content once in the total and mark the copies", apply: func(p *parser, value string) error {
+		p.config.Dedupe = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.Dedupe) }},
+	{long: "format", value: "NAME", choices: wc.FormatterNames(), usage: "print counts with the output format NAME: " + strings.Join(wc.FormatterNames(), ", "), apply: func(p *parser, value string) error {
+		if _, ok := wc.LookupFormatter(value); !ok {
+			return fmt.Errorf("invalid value for --format: use one of %s", strings.Join(wc.FormatterNames(), ", "))
+		}
+		p.config.Format = value
+		p.setSources("json")
+		return nil
+	}, show: func(c Config) string { return tomlQuote(c.Format) }},
+	{long: "json", usage: "output counts as JSON; same as --format=json", apply: func(p *parser, value string) error {
+		if value == "true" {
+			p.config.Format = "json"
+		} else if p.config.Format == "json" {
+			p.config.Format = "text"
+		}
+		p.setSources("format")
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.JSON) }},
+	{long: "io", value: "MODE", choices: ioModeNames(), usage: "read files with MODE: " + strings.Join(ioModeNames(), ", "), apply: func(p *parser, value string) error {
+		mode, ok := wc.ParseIOMode(value)
+		if !ok {
+			return fmt.Errorf("invalid value for --io: use auto, read, or mmap")
+		}
+		p.config.IO = mode
+		return nil
+	}, show: func(c Config) string { return tomlQuote(string(c.IO)) }},
+	{long: "jobs", value: "N", usage: "count up to N files concurrently (0: one per available CPU)", apply: func(p *parser, value string) error {
+		jobs, err := strconv.Atoi(value)
+		if err != nil || jobs < 0 {
+			return fmt.Errorf("invalid value for --jobs: use a non-negative integer")
+		}
+		p.config.Jobs = jobs
+		return nil
+	}, show: func(c Config) string { return strconv.Itoa(c.Jobs) }},
+	{long: "input-timeout", value: "DURATION", usage: "give up on a URL or command input after DURATION, e.g. 30s (0: never)", apply: func(p *parser, value string) error {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid value for --input-timeout: use a non-negative duration such as 30s")
+		}
+		p.config.InputTimeout = timeout
+		return nil
+	}, show: func(c Config) string { return tomlQuote(c.InputTimeout.String()) }},
+	{long: "cache", value: "PATH", file: true, userOnly: true, usage: "reuse counts of unchanged files stored in PATH, and store new ones", apply: func(p *parser, value string) error {
+		p.config.Cache = value
+		return nil
+	}, show: func(c Config) string { return tomlQuote(c.Cache) }},
+	{long: "cache-stats", usage: "report cache hits and misses on standard error", apply: func(p *parser, value string) error {
+		p.config.CacheStats = value == "true"
+		return nil
+	}, show: func(c Config) string { return strconv.FormatBool(c.CacheStats) }},
+	{long: "allow-exec", usage: "allow exec://COMMAND operands, which run COMMAND and count its output, and schemes in --files0-from names", apply: func(p *parser, value string) error {
+		p.config.AllowExec = value == "true"
+		return nil
+	}},
+	{long: "profile", value: "NAME", usage: "apply the [profile.NAME] block of the config files", apply: func(p *parser, value string) error {
+		p.config.Profile = value
+		return nil
+	}},
+	{long: "print-config", usage: "print the effective settings and their sources, then exit", apply: func(p *parser, value string) error {
+		p.config.PrintConfig = value == "true"
+		return nil
+	}},
+	{long: "completion", value: "SHELL", choices: completionShells, usage: "print a completion script for SHELL: " + strings.Join(completionShells, ", "), apply: func(p *parser, value string) error {
+		if !containsString(completionShells, value) {
+			return fmt.Errorf("invalid value for --completion: use bash, zsh, or fish")
+		}
+		p.config.Completion = value
+		return nil
+	}},
+	{long: "version", usage: "output version information and exit", apply: func(p *parser, value string) error {
+		p.config.Version = value == "true"
+		return nil
+	}},
+	{short: 'h', long: "help", usage: "show help", apply: func(p *parser, value string) error {
+		p.config.Help = value == "true"
+		return nil
+	}},
+}
+
+func totalModeNames() []string {
+	return []string{string(wc.TotalAuto), string(wc.TotalAlways), string(wc.TotalOnly), string(wc.TotalNever)}
+}
+
+func ioModeNames() []string {
+	return []string{string(wc.IOAuto), string(wc.IORead), string(wc.IOMmap)}
+}
+
+func binaryPolicyNames() []string {
+	return []string{string(wc.BinaryCount), string(wc.BinarySkip), string(wc.BinaryReport)}
+}
+
+func lineEndingNames() []string {
+	return []string{string(wc.EOLLF), string(wc.EOLCRLF), "none"}
+}
+
+// sliceOptions all set Config.Slice.
+var sliceOptions = []string{"bytes-range", "lines-range", "head", "tail"}
+
+// applySlice sets the slice from a range option; "none" clears it.
+func (p *parser) applySlice(name string, unit wc.SliceUnit, value string) error {
+	p.setSources(sliceOptions...)
+	if value == "none" {
+		p.config.Slice = wc.Slice{}
+		return nil
+	}
+	slice, ok := wc.ParseSlice(unit, value)
+	if !ok {
+		return fmt.Errorf("invalid value for --%s: use START:END counting from 1, with either side empty, or -N: for the last N", name)
+	}
+	p.config.Slice = slice
+	return nil
+}
+
+func showSlice(slice wc.Slice, unit wc.SliceUnit) string {
+	if slice.Unit != unit || slice.IsZero() {
+		return tomlQuote("none")
+	}
+	return tomlQuote(slice.String())
+}
+
+func breakdownNames() []string {
+	return []string{string(wc.BreakdownScript), string(wc.BreakdownCategory), "none"}
+}
+
+func hashNames() []string {
+	return append(wc.HashNames(), "none")
+}
+
+func isWhitespaceMetric(metric wc.Metric) bool {
+	for _, whitespace := range wc.WhitespaceMetrics() {
+		if metric.Name() == whitespace.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// registeredMetricNames names the metrics --metric selects, leaving out the
+// match columns, which have options of their own.
+func registeredMetricNames(metrics []wc.Metric) []string {
+	names := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		if _, ok := metric.(*wc.MatchMetric); !ok {
+			names = append(names, metric.Name())
+		}
+	}
+
+	return names
+}
+
+// applyMatch adds a match column from a NAME=REGEX value.
+func (p *parser) applyMatch(name string, unit wc.MatchUnit, value string) error {
+	column, expr, ok := strings.Cut(value, "=")
+	if !ok || column == "" {
+		return fmt.Errorf("invalid value for --%s: use NAME=REGEX", name)
+	}
+	builtin := wc.SelectionFromFlags(true, true, true, true, true).Fields()
+	if _, registered := wc.LookupMetric(column); registered || containsString(builtin, column) {
+		return fmt.Errorf("invalid value for --%s: %q is already a metric", name, column)
+	}
+	for _, selected := range p.flags.metrics {
+		if selected.Name() == column {
+			return fmt.Errorf("invalid value for --%s: column %q is given twice", name, column)
+		}
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid value for --%s: %v", name, err)
+	}
+
+	p.flags.metrics = append(p.flags.metrics, wc.NewMatchMetric(column, pattern, unit))
+	return nil
+}
+
+// matchSpecs renders the match columns counting unit as NAME=REGEX.
+func matchSpecs(metrics []wc.Metric, unit wc.MatchUnit) []string {
+	var specs []string
+	for _, metric := range metrics {
+		if match, ok := metric.(*wc.MatchMetric); ok && match.Unit() == unit {
+			specs = append(specs, match.Name()+"="+match.Pattern().String())
+		}
+	}
+
+	return specs
+}
+
+func lookupLong(name string) (option, bool) {
+	for _, opt := range options {
+		if opt.long == name {
+			return opt, true
+		}
+	}
+
+	return option{}, false
+}
+
+func lookupShort(short rune) (option, bool) {
+	for _, opt := range options {
+		if opt.short != 0 && opt.short == short {
+			return opt, true
+		}
+	}
+
+	return option{}, false
+}
+
+// assignment is one option occurrence waiting to be applied.
+type assignment struct {
+	opt   option
+	value string
+}
+
+// layer groups the assignments from one source. Layers are applied in order,
+// so later layers take precedence over earlier ones.
+type layer struct {
+	source      string
+	assignments []assignment
 }
 
 // Parse handles GNU-like short/long flags and keeps operands in original order.
 // A lone "-" is treated as a file operand (stdin), not as an option prefix.
 func Parse(args []string) (Config, error) {
-	config := Config{TotalMode: wc.TotalAuto}
-	flags := parseFlags{}
+	assignments, operands, err := tokenize(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return resolve([]layer{{source: sourceCommandLine, assignments: assignments}}, operands)
+}
+
+// tokenize splits args into option assignments and operands without applying
+// them, so the same syntax can be layered with config file settings.
+func tokenize(args []string) ([]assignment, []string, error) {
+	var assignments []assignment
+	var operands []string
 
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 
 		if arg == "--" {
-			config.Args = append(config.Args, args[i+1:]...)
+			operands = append(operands, args[i+1:]...)
 			break
 		}
 
 		if strings.HasPrefix(arg, "--") {
 			name, value, hasValue := splitLongOption(arg[2:])
-			switch name {
-			case "bytes":
-				flags.bytes = true
-			case "lines":
-				flags.lines = true
-			case "words":
-				flags.words = true
-			case "chars":
-				flags.chars = true
-			case "max-line-length":
-				flags.maxLineLength = true
-			case "files0-from":
-				if !hasValue {
-					if i+1 >= len(args) {
-						return Config{}, fmt.Errorf("missing value for --files0-from")
-					}
-					i++
-					value = args[i]
-				}
-				config.Files0From = value
-			case "total":
-				if !hasValue {
+			opt, ok := lookupLong(name)
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown option: --%s", name)
+			}
+			if !hasValue {
+				if opt.value == "" {
+					value = "true"
+				} else {
 					if i+1 >= len(args) {
-						return Config{}, fmt.Errorf("missing value for --total")
+						return nil, nil, fmt.Errorf("missing value for --%s", name)
 					}
 					i++
 					value = args[i]
 				}
-				mode, ok := wc.ParseTotalMode(value)
-				if !ok {
-					return Config{}, fmt.Errorf("invalid value for --total: use auto, always, only, or never")
-				}
-				config.TotalMode = mode
-			case "json":
-				config.JSON = true
-			case "version":
-				config.Version = true
-			case "help":
-				config.Help = true
-			default:
-				return Config{}, fmt.Errorf("unknown option: --%s", name)
 			}
+			assignments = append(assignments, assignment{opt: opt, value: value})
 			continue
 		}
 
 		if strings.HasPrefix(arg, "-") && arg != "-" {
 			for _, short := range arg[1:] {
-				switch short {
-				case 'c':
-					flags.bytes = true
-				case 'l':
-					flags.lines = true
-				case 'w':
-					flags.words = true
-				case 'm':
-					flags.chars = true
-				case 'L':
-					flags.maxLineLength = true
-				case 'h':
-					config.Help = true
-				default:
-					return Config{}, fmt.Errorf("unknown option: -%c", short)
+				opt, ok := lookupShort(short)
+				if !ok || opt.value != "" {
+					return nil, nil, fmt.Errorf("unknown option: -%c", short)
 				}
+				assignments = append(assignments, assignment{opt: opt, value: "true"})
 			}
 			continue
 		}
 
-		config.Args = append(config.Args, arg)
+		operands = append(operands, arg)
+	}
+
+	return assignments, operands, nil
+}
+
+// resolve applies layers over the built-in defaults. A layer that selects any
+// count replaces the counts chosen by lower layers instead of adding to them,
+// so "-l" on the command line is not widened by "words = true" in a file.
+func resolve(layers []layer, operands []string) (Config, error) {
+	p := parser{
+		config:  Config{TotalMode: wc.TotalAuto, Format: "text", IO: wc.IOAuto, Binary: wc.BinaryCount},
+		sources: make(map[string]string),
+	}
+
+	for _, current := range layers {
+		p.source = current.source
+		for _, a := range current.assignments {
+			if a.opt.count {
+				p.flags = parseFlags{}
+				for _, opt := range options {
+					if opt.count {
+						p.sources[opt.long] = current.source
+					}
+				}
+				break
+			}
+		}
+
+		for _, a := range current.assignments {
+			value := a.value
+			if a.opt.value == "" {
+				enabled, err := strconv.ParseBool(value)
+				if err != nil {
+					return Config{}, fmt.Errorf("invalid value for --%s: %q is not a boolean", a.opt.long, value)
+				}
+				value = strconv.FormatBool(enabled)
+			}
+			if err := a.opt.apply(&p, value); err != nil {
+				return Config{}, err
+			}
+			p.sources[a.opt.long] = current.source
+		}
+	}
+
+	p.config.Args = operands
+	p.config.JSON = p.config.Format == "json"
+	p.config.Selection = wc.CountSelection{
+		Lines:         p.flags.lines,
+		Words:         p.flags.words,
+		Chars:         p.flags.chars,
+		Bytes:         p.flags.bytes,
+		MaxLineLength: p.flags.maxLineLength,
+		Extra:         p.flags.metrics,
+	}
+	if len(p.config.Selection.Selected()) == 0 {
+		p.config.Selection = wc.DefaultSelection()
+	}
+	p.config.Selection.Hash = p.config.Hash
+	p.config.Selection.EOL = p.config.EOLStats
+	p.config.Selection.Findings = p.config.ListFindings
+	p.config.Selection.Encoding = p.config.CheckEncoding
+	p.config.Selection.Breakdown = p.config.Breakdown
+	p.config.Selection.RecordDelimiter = p.config.RecordDelimiter
+	p.config.Selection.UnicodeLineBreaks = p.config.UnicodeNewlines
+	if p.config.WhereLine != "" {
+		p.config.Selection.WhereLine = regexp.MustCompile(p.config.WhereLine)
+	}
+	if p.config.WhereNotLine != "" {
+		p.config.Selection.WhereNotLine = regexp.MustCompile(p.config.WhereNotLine)
 	}
 
-	config.Selection = wc.SelectionFromFlags(
-		flags.lines,
-		flags.words,
-		flags.chars,
-		flags.bytes,
-		flags.maxLineLength,
-	)
+	for _, opt := range options {
+		if opt.show == nil {
+			continue
+		}
+		source, ok := p.sources[opt.long]
+		if !ok {
+			source = sourceDefault
+		}
+		p.config.Settings = append(p.config.Settings, Setting{
+			Name:   opt.long,
+			Value:  opt.show(p.config),
+			Source: source,
+		})
+	}
 
-	return config, nil
+	return p.config, nil
 }
 
 func splitLongOption(arg string) (name string, value string, hasValue bool) {
@@ -131,10 +754,45 @@ func splitLongOption(arg string) (name string, value string, hasValue bool) {
 	return arg, "", false
 }
 
-// HelpText is static to keep output stable across Go versions and avoid
-// differences from the standard flag package formatter.
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tomlStringArray(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, tomlQuote(value))
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// optionLabel renders the left-hand column of the help output, e.g.
+// "-c, --bytes" or "    --total=WHEN".
+func optionLabel(opt option) string {
+	label := "    "
+	if opt.short != 0 {
+		label = "-" + string(opt.short) + ", "
+	}
+	label += "--" + opt.long
+	if opt.value != "" {
+		label += "=" + opt.value
+	}
+
+	return label
+}
+
+// HelpText is rendered from the option table rather than the standard flag
+// package formatter to keep output stable across Go versions.
 func HelpText() string {
-	return `NAME:
+	var builder strings.Builder
+	builder.WriteString(`NAME:
    wcx - print newline, word, and byte counts for each file
 
 USAGE:
@@ -144,15 +802,23 @@ DESCRIPTION:
    Drop-in compatible wc replacement with optional JSON output.
 
 OPTIONS:
-   -c, --bytes             print the byte counts
-   -l, --lines             print the newline counts
-   -w, --words             print the word counts
-   -m, --chars             print the character counts
-   -L, --max-line-length   print the maximum display width
-       --files0-from=F     read input from NUL-terminated names in file F
-       --total=WHEN        WHEN to print total counts: auto, always, only, never
-       --json              output counts as JSON (wcx extension)
-       --version           output version information and exit
-   -h, --help              show help
-`
+`)
+
+	width := 0
+	for _, opt := range options {
+		width = max(width, len(optionLabel(opt)))
+	}
+
+	for _, opt := range options {
+		fmt.Fprintf(&builder, "   %-*s   %s\n", width, optionLabel(opt), opt.usage)
+	}
+
+	builder.WriteString(`
+CONFIGURATION:
+   Defaults are read from $XDG_CONFIG_HOME/wcx/config.toml, then from the
+   nearest .wcx.toml in the working directory or its parents, then from the
+   WCX_OPTIONS environment variable. The command line overrides them all.
+`)
+
+	return builder.String()
 }
@@ -1,12 +1,36 @@
 package cli
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
+	"time"
 
 	"cc/wcx/internal/wc"
 )
 
+// tabMetric counts tab bytes; it is registered so --metric has something to
+// select.
+type tabMetric struct{}
+
+func (tabMetric) Name() string                   { return "tabs" }
+func (tabMetric) NewAccumulator() wc.Accumulator { return &tabAccumulator{} }
+func (tabMetric) Merge(total int, value int) int { return total + value }
+
+type tabAccumulator struct {
+	tabs int
+}
+
+func (a *tabAccumulator) AddChunk(p []byte) { a.tabs += bytes.Count(p, []byte{'\t'}) }
+
+func (a *tabAccumulator) Value() int { return a.tabs }
+
+func init() {
+	if err := wc.RegisterMetric(tabMetric{}); err != nil {
+		panic(err)
+	}
+}
+
 func TestParse(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -18,7 +42,7 @@ func TestParse(t *testing.T) {
 			name: "default selection and args",
 			args: []string{"file.txt"},
 			check: func(t *testing.T, config Config) {
-				if config.Selection != wc.DefaultSelection() {
+				if !config.Selection.Equal(wc.DefaultSelection()) {
 					t.Fatalf("default selection mismatch: %+v", config.Selection)
 				}
 				if config.TotalMode != wc.TotalAuto {
@@ -34,7 +58,7 @@ func TestParse(t *testing.T) {
 			args: []string{"-lm", "file.txt"},
 			check: func(t *testing.T, config Config) {
 				want := wc.SelectionFromFlags(true, false, true, false, false)
-				if config.Selection != want {
+				if !config.Selection.Equal(want) {
 					t.Fatalf("selection mismatch: got %+v want %+v", config.Selection, want)
 				}
 			},
@@ -51,6 +75,306 @@ func TestParse(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "completion shell",
+			args: []string{"--completion", "zsh"},
+			check: func(t *testing.T, config Config) {
+				if config.Completion != "zsh" {
+					t.Fatalf("completion mismatch: got %q", config.Completion)
+				}
+			},
+		},
+		{
+			name:      "invalid completion shell returns error",
+			args:      []string{"--completion=tcsh"},
+			wantError: true,
+		},
+		{
+			name: "jobs value",
+			args: []string{"--jobs=4", "--io", "mmap"},
+			check: func(t *testing.T, config Config) {
+				if config.Jobs != 4 {
+					t.Fatalf("jobs mismatch: got %d want 4", config.Jobs)
+				}
+				if config.IO != wc.IOMmap {
+					t.Fatalf("io mode mismatch: got %q", config.IO)
+				}
+			},
+		},
+		{
+			name: "metric alone replaces the default selection",
+			args: []string{"--metric=tabs", "--metric", "tabs"},
+			check: func(t *testing.T, config Config) {
+				if got := config.Selection.Fields(); !reflect.DeepEqual(got, []string{"tabs"}) {
+					t.Fatalf("selected fields mismatch: got %v", got)
+				}
+			},
+		},
+		{
+			name:      "unregistered metric returns error",
+			args:      []string{"--metric=nope"},
+			wantError: true,
+		},
+		{
+			name: "input timeout and exec opt-in",
+			args: []string{"--input-timeout=1m30s", "--allow-exec"},
+			check: func(t *testing.T, config Config) {
+				if config.InputTimeout != 90*time.Second || !config.AllowExec {
+					t.Fatalf("unexpected config: timeout %v allow-exec %v", config.InputTimeout, config.AllowExec)
+				}
+			},
+		},
+		{
+			name:      "invalid input timeout returns error",
+			args:      []string{"--input-timeout=soon"},
+			wantError: true,
+		},
+		{
+			name: "json is an alias for the json format",
+			args: []string{"--format=json", "--json=false"},
+			check: func(t *testing.T, config Config) {
+				if config.Format != "text" || config.JSON {
+					t.Fatalf("format mismatch: got %q json=%v", config.Format, config.JSON)
+				}
+			},
+		},
+		{
+			name:      "unknown format returns error",
+			args:      []string{"--format=yaml"},
+			wantError: true,
+		},
+		{
+			name: "hash and dedupe",
+			args: []string{"--hash=xxh64", "--dedupe", "-l"},
+			check: func(t *testing.T, config Config) {
+				if config.Selection.Hash != "xxh64" || !config.Selection.Lines || !config.Dedupe {
+					t.Fatalf("unexpected config: selection %+v dedupe %v", config.Selection, config.Dedupe)
+				}
+			},
+		},
+		{
+			name: "hash none clears an earlier hash",
+			args: []string{"--hash=sha256", "--hash=none"},
+			check: func(t *testing.T, config Config) {
+				if config.Selection.Hash != "" {
+					t.Fatalf("hash mismatch: got %q", config.Selection.Hash)
+				}
+			},
+		},
+		{
+			name: "binary policy",
+			args: []string{"--binary=SKIP"},
+			check: func(t *testing.T, config Config) {
+				if config.Binary != wc.BinarySkip {
+					t.Fatalf("binary policy mismatch: got %q", config.Binary)
+				}
+			},
+		},
+		{
+			name:      "invalid binary policy returns error",
+			args:      []string{"--binary=ignore"},
+			wantError: true,
+		},
+		{
+			name: "line ending stats and requirement",
+			args: []string{"--eol-stats", "--require-eol=crlf"},
+			check: func(t *testing.T, config Config) {
+				if !config.Selection.EOL || config.RequireEOL != wc.EOLCRLF {
+					t.Fatalf("unexpected config: selection %+v require-eol %q", config.Selection, config.RequireEOL)
+				}
+			},
+		},
+		{
+			name:      "invalid line ending returns error",
+			args:      []string{"--require-eol=cr"},
+			wantError: true,
+		},
+		{
+			name: "encoding report and requirement",
+			args: []string{"--check-encoding", "--require-utf8"},
+			check: func(t *testing.T, config Config) {
+				if !config.Selection.Encoding || !config.RequireUTF8 {
+					t.Fatalf("unexpected config: selection %+v require-utf8 %v", config.Selection, config.RequireUTF8)
+				}
+			},
+		},
+		{
+			name: "breakdown mode",
+			args: []string{"-m", "--breakdown=category"},
+			check: func(t *testing.T, config Config) {
+				if config.Selection.Breakdown != wc.BreakdownCategory || !config.Selection.Chars {
+					t.Fatalf("unexpected selection: %+v", config.Selection)
+				}
+			},
+		},
+		{
+			name:      "invalid breakdown returns error",
+			args:      []string{"--breakdown=block"},
+			wantError: true,
+		},
+		{
+			name: "tail replaces an earlier range",
+			args: []string{"--bytes-range=10:20", "--tail=100"},
+			check: func(t *testing.T, config Config) {
+				if want := (wc.Slice{Unit: wc.SliceLines, Start: 100, Last: true}); config.Slice != want {
+					t.Fatalf("unexpected slice: got %+v want %+v", config.Slice, want)
+				}
+			},
+		},
+		{
+			name: "head and lines range",
+			args: []string{"--head=5", "--lines-range=2:4"},
+			check: func(t *testing.T, config Config) {
+				if want := (wc.Slice{Unit: wc.SliceLines, Start: 2, End: 4}); config.Slice != want {
+					t.Fatalf("unexpected slice: got %+v want %+v", config.Slice, want)
+				}
+			},
+		},
+		{
+			name: "head of zero lines selects nothing",
+			args: []string{"--head=0"},
+			check: func(t *testing.T, config Config) {
+				if want := (wc.Slice{Unit: wc.SliceLines, Last: true}); config.Slice != want {
+					t.Fatalf("unexpected slice: got %+v want %+v", config.Slice, want)
+				}
+			},
+		},
+		{
+			name: "tail of zero lines is not unset",
+			args: []string{"--tail=0"},
+			check: func(t *testing.T, config Config) {
+				if want := (wc.Slice{Unit: wc.SliceLines, Last: true}); config.Slice != want {
+					t.Fatalf("unexpected slice: got %+v want %+v", config.Slice, want)
+				}
+				shown := map[string]string{}
+				for _, setting := range config.Settings {
+					shown[setting.Name] = setting.Value
+				}
+				if shown["tail"] != "0" || shown["head"] != `"none"` {
+					t.Fatalf("unexpected settings: tail %s, head %s", shown["tail"], shown["head"])
+				}
+			},
+		},
+		{
+			name: "bytes range ending at zero selects nothing",
+			args: []string{"--bytes-range=:0"},
+			check: func(t *testing.T, config Config) {
+				if want := (wc.Slice{Unit: wc.SliceBytes, Last: true}); config.Slice != want {
+					t.Fatalf("unexpected slice: got %+v want %+v", config.Slice, want)
+				}
+			},
+		},
+		{
+			name: "unset head and tail show none",
+			args: []string{"-l"},
+			check: func(t *testing.T, config Config) {
+				for _, setting := range config.Settings {
+					if (setting.Name == "head" || setting.Name == "tail") && setting.Value != `"none"` {
+						t.Fatalf("unexpected %s setting: %s", setting.Name, setting.Value)
+					}
+				}
+			},
+		},
+		{
+			name:      "invalid bytes range returns error",
+			args:      []string{"--bytes-range=20:10"},
+			wantError: true,
+		},
+		{
+			name: "match columns keep their order",
+			args: []string{"-l", "--count-matching-lines=errors=ERROR|FATAL", "--count-matches=warnings=WARN"},
+			check: func(t *testing.T, config Config) {
+				if want := []string{"lines", "errors", "warnings"}; !reflect.DeepEqual(config.Selection.Fields(), want) {
+					t.Fatalf("unexpected fields: got %v want %v", config.Selection.Fields(), want)
+				}
+				errors, ok := config.Selection.Extra[0].(*wc.MatchMetric)
+				if !ok || errors.Unit() != wc.MatchLines || errors.Pattern().String() != "ERROR|FATAL" {
+					t.Fatalf("unexpected metric: %+v", config.Selection.Extra[0])
+				}
+			},
+		},
+		{
+			name:      "match column without a name returns error",
+			args:      []string{"--count-matches=ERROR"},
+			wantError: true,
+		},
+		{
+			name:      "match column named after a metric returns error",
+			args:      []string{"--count-matches=words=x"},
+			wantError: true,
+		},
+		{
+			name:      "invalid match pattern returns error",
+			args:      []string{"--count-matches=bad=("},
+			wantError: true,
+		},
+		{
+			name: "line filters",
+			args: []string{"--where-line=\\w", "--where-not-line=^#"},
+			check: func(t *testing.T, config Config) {
+				where, whereNot := config.Selection.WhereLine, config.Selection.WhereNotLine
+				if where == nil || where.String() != `\w` || whereNot == nil || whereNot.String() != "^#" {
+					t.Fatalf("unexpected filters: %v, %v", where, whereNot)
+				}
+			},
+		},
+		{
+			name:      "invalid line filter returns error",
+			args:      []string{"--where-not-line=["},
+			wantError: true,
+		},
+		{
+			name: "record delimiter escapes",
+			args: []string{`--record-delimiter=\x1e`},
+			check: func(t *testing.T, config Config) {
+				if config.Selection.RecordDelimiter != "\x1e" {
+					t.Fatalf("unexpected record delimiter: %q", config.Selection.RecordDelimiter)
+				}
+			},
+		},
+		{
+			name: "null data",
+			args: []string{"-lz"},
+			check: func(t *testing.T, config Config) {
+				if config.Selection.RecordDelimiter != "\x00" || !config.Selection.Lines {
+					t.Fatalf("unexpected selection: %+v", config.Selection)
+				}
+			},
+		},
+		{
+			name:      "multi-character record delimiter returns error",
+			args:      []string{"--record-delimiter=ab"},
+			wantError: true,
+		},
+		{
+			name: "unicode newlines",
+			args: []string{"-lL", "--unicode-newlines"},
+			check: func(t *testing.T, config Config) {
+				if !config.Selection.UnicodeLineBreaks || !config.Selection.Lines || !config.Selection.MaxLineLength {
+					t.Fatalf("unexpected selection: %+v", config.Selection)
+				}
+			},
+		},
+		{
+			name: "whitespace metrics and findings",
+			args: []string{"-l", "--metric=maxIndent", "--whitespace", "--list-findings"},
+			check: func(t *testing.T, config Config) {
+				want := []string{"lines", "trailingWhitespace", "tabIndented", "spaceIndented", "mixedIndented", "maxIndent"}
+				if got := config.Selection.Fields(); !reflect.DeepEqual(got, want) || !config.Selection.Findings {
+					t.Fatalf("unexpected selection: fields %v findings %v", got, config.Selection.Findings)
+				}
+			},
+		},
+		{
+			name:      "unknown hash returns error",
+			args:      []string{"--hash=md5"},
+			wantError: true,
+		},
+		{
+			name:      "negative jobs returns error",
+			args:      []string{"--jobs=-1"},
+			wantError: true,
+		},
 		{
 			name:      "invalid total value returns error",
 			args:      []string{"--total=bad"},
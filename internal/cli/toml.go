@@ -0,0 +1,329 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlEntry is one "key = value" pair from a config file. Values are kept as
+// the strings the option table expects, so booleans become "true"/"false" and
+// integers their decimal form.
+type tomlEntry struct {
+	table  string
+	key    string
+	values []string
+	array  bool
+	line   int
+}
+
+// parseTOML understands the subset of TOML used by wcx config files: comments,
+// [table] headers, and keys holding strings, booleans, integers, or arrays of
+// those. Anything else is reported rather than silently ignored. The names of
+// all declared tables are returned alongside the entries.
+func parseTOML(data string) ([]tomlEntry, []string, error) {
+	var entries []tomlEntry
+	var tables []string
+	table := ""
+
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := strings.TrimSpace(stripTOMLComment(lines[i]))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, nil, fmt.Errorf("line %d: invalid table header", lineNumber)
+			}
+			name, err := parseTOMLTableName(strings.TrimSpace(line[1 : len(line)-1]))
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			table = name
+			tables = append(tables, name)
+			continue
+		}
+
+		key, rawValue, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("line %d: expected key = value", lineNumber)
+		}
+		key, err := parseTOMLKey(strings.TrimSpace(key))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		rawValue = strings.TrimSpace(rawValue)
+		// Arrays may span several lines; keep consuming until brackets balance.
+		for strings.HasPrefix(rawValue, "[") && !tomlArrayClosed(rawValue) && i+1 < len(lines) {
+			i++
+			rawValue += " " + strings.TrimSpace(stripTOMLComment(lines[i]))
+		}
+
+		entry := tomlEntry{table: table, key: key, line: lineNumber}
+		if strings.HasPrefix(rawValue, "[") {
+			entry.array = true
+			entry.values, err = parseTOMLArray(rawValue)
+		} else {
+			var value string
+			value, err = parseTOMLScalar(rawValue)
+			entry.values = []string{value}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, tables, nil
+}
+
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+func tomlArrayClosed(value string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+
+	return depth == 0
+}
+
+func parseTOMLTableName(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		key, err := parseTOMLKey(strings.TrimSpace(part))
+		if err != nil {
+			return "", err
+		}
+		parts[i] = key
+	}
+
+	return strings.Join(parts, "."), nil
+}
+
+func parseTOMLKey(key string) (string, error) {
+	if strings.HasPrefix(key, `"`) || strings.HasPrefix(key, "'") {
+		return parseTOMLString(key)
+	}
+
+	if key == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", fmt.Errorf("invalid key %q", key)
+		}
+	}
+
+	return key, nil
+}
+
+func parseTOMLScalar(value string) (string, error) {
+	switch {
+	case value == "true" || value == "false":
+		return value, nil
+	case strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'"):
+		return parseTOMLString(value)
+	}
+
+	number, err := strconv.ParseInt(strings.ReplaceAll(value, "_", ""), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("unsupported value %s", value)
+	}
+
+	return strconv.FormatInt(number, 10), nil
+}
+
+func parseTOMLString(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		literal := value[1 : len(value)-1]
+		if strings.Contains(literal, "'") {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return literal, nil
+	}
+
+	unquoted, ok := unquoteTOMLBasic(value)
+	if !ok {
+		return "", fmt.Errorf("invalid string %s", value)
+	}
+
+	return unquoted, nil
+}
+
+// tomlEscapes maps the TOML escape characters other than u and U to what they
+// stand for.
+var tomlEscapes = map[byte]byte{'b': '\b', 't': '\t', 'n': '\n', 'f': '\f', 'r': '\r', '"': '"', '\\': '\\'}
+
+// unquoteTOMLBasic decodes a TOML basic string, the mirror image of
+// tomlQuote. Unlike strconv.Unquote it rejects Go-only escapes such as \x41,
+// \a, and \101, and control characters other than tab.
+func unquoteTOMLBasic(value string) (string, bool) {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' || !utf8.ValidString(value) {
+		return "", false
+	}
+
+	var builder strings.Builder
+	inner := value[1 : len(value)-1]
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case c == '"' || c < 0x20 && c != '\t' || c == 0x7f:
+			return "", false
+		case c != '\\':
+			builder.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(inner) {
+			return "", false
+		}
+		if decoded, ok := tomlEscapes[inner[i]]; ok {
+			builder.WriteByte(decoded)
+			continue
+		}
+
+		digits := 0
+		switch inner[i] {
+		case 'u':
+			digits = 4
+		case 'U':
+			digits = 8
+		default:
+			return "", false
+		}
+		if i+digits >= len(inner) {
+			return "", false
+		}
+		code, err := strconv.ParseUint(inner[i+1:i+1+digits], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return "", false
+		}
+		builder.WriteRune(rune(code))
+		i += digits
+	}
+
+	return builder.String(), true
+}
+
+// tomlQuote renders value as a TOML basic string. Unlike strconv.Quote it
+// only uses escapes TOML defines, so other control characters become \uXXXX.
+// TOML text is UTF-8; invalid bytes are written as U+FFFD.
+func tomlQuote(value string) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for _, r := range strings.ToValidUTF8(value, "\uFFFD") {
+		switch r {
+		case '"':
+			builder.WriteString(`\"`)
+		case '\\':
+			builder.WriteString(`\\`)
+		case '\b':
+			builder.WriteString(`\b`)
+		case '\t':
+			builder.WriteString(`\t`)
+		case '\n':
+			builder.WriteString(`\n`)
+		case '\f':
+			builder.WriteString(`\f`)
+		case '\r':
+			builder.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&builder, `\u%04X`, r)
+			} else {
+				builder.WriteRune(r)
+			}
+		}
+	}
+	builder.WriteByte('"')
+
+	return builder.String()
+}
+
+func parseTOMLArray(value string) ([]string, error) {
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unterminated array")
+	}
+
+	inner := strings.TrimSpace(value[1 : len(value)-1])
+	values := []string{}
+	for inner != "" {
+		end := tomlElementEnd(inner)
+		element := strings.TrimSpace(inner[:end])
+		if strings.HasPrefix(element, "[") {
+			return nil, fmt.Errorf("nested arrays are not supported")
+		}
+		parsed, err := parseTOMLScalar(element)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, parsed)
+
+		inner = strings.TrimSpace(inner[end:])
+		inner = strings.TrimSpace(strings.TrimPrefix(inner, ","))
+	}
+
+	return values, nil
+}
+
+// tomlElementEnd returns the offset of the comma ending the first element of
+// an array body, or the body length for the last element.
+func tomlElementEnd(inner string) int {
+	var quote byte
+	for i := 0; i < len(inner); i++ {
+		switch c := inner[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			return i
+		}
+	}
+
+	return len(inner)
+}
@@ -0,0 +1,72 @@
+package digest_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"testing"
+
+	"cc/wcx/internal/digest"
+)
+
+func TestKnownDigests(t *testing.T) {
+	sequence := make([]byte, 0, 1280)
+	for i := 0; i < 5; i++ {
+		for b := 0; b < 256; b++ {
+			sequence = append(sequence, byte(b))
+		}
+	}
+
+	tests := []struct {
+		name  string
+		hash  func() hash.Hash
+		input string
+		want  string
+	}{
+		{name: "xxh64 empty", hash: func() hash.Hash { return digest.NewXXH64() }, input: "", want: "ef46db3751d8e999"},
+		{name: "xxh64 short", hash: func() hash.Hash { return digest.NewXXH64() }, input: "abc", want: "44bc2cf5ad770999"},
+		{name: "xxh64 stripes", hash: func() hash.Hash { return digest.NewXXH64() }, input: "Nobody inspects the spammish repetition", want: "fbcea83c8a378bf1"},
+		{name: "blake2b empty", hash: digest.NewBLAKE2b512, input: "", want: "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{name: "blake2b short", hash: digest.NewBLAKE2b512, input: "abc", want: "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{name: "blake2b one block", hash: digest.NewBLAKE2b512, input: strings.Repeat("a", 128), want: "fc6c71f688f43ea7d60817478808f3cac753e61571865c95adbc2d9122c943a76b92c2cb1047ef3fe7bf6e436ec1d0a99a9e5b216780bf7fed9d7ca91d3a8f3b"},
+		{name: "blake2b past a block", hash: digest.NewBLAKE2b512, input: strings.Repeat("a", 129), want: "55e6e0eb418149a8af92fd9ddc99254781b2f522a131b4f4d984404b71a00e1167b8124d5dcddd4c6977b299392335d6edd303da6d344d74bbef2d38101b232b"},
+		{name: "blake2b blocks", hash: digest.NewBLAKE2b512, input: string(sequence), want: "a86b784c748f990b998e6d30d71e20cc95228d2b08dd85e29f63e4de8d8839bdf935f4291537af5014fe44c0b578a073e4c9217c7b05542d0c450784c30bac8a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := test.hash()
+			_, _ = h.Write([]byte(test.input))
+			if got := hex.EncodeToString(h.Sum(nil)); got != test.want {
+				t.Fatalf("digest mismatch: got %s want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDigestsIgnoreChunkBoundaries(t *testing.T) {
+	input := bytes.Repeat([]byte("0123456789abcdef"), 40)
+
+	for _, create := range []func() hash.Hash{func() hash.Hash { return digest.NewXXH64() }, digest.NewBLAKE2b512} {
+		whole := create()
+		_, _ = whole.Write(input)
+		want := whole.Sum(nil)
+
+		for size := 1; size <= 300; size += 7 {
+			h := create()
+			for rest := input; len(rest) > 0; {
+				n := min(size, len(rest))
+				_, _ = h.Write(rest[:n])
+				rest = rest[n:]
+			}
+			if got := h.Sum(nil); !bytes.Equal(got, want) {
+				t.Fatalf("chunks of %d: got %x want %x", size, got, want)
+			}
+			// Sum must not disturb the state.
+			if got := h.Sum(nil); !bytes.Equal(got, want) {
+				t.Fatalf("second Sum differs for chunks of %d", size)
+			}
+		}
+	}
+}
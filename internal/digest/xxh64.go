@@ -0,0 +1,121 @@
+// Package digest implements the non-cryptographic and cryptographic content
+// hashes wcx offers that the standard library does not.
+package digest
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+// xxh64 is XXH64 with a zero seed, processing 32-byte stripes.
+type xxh64 struct {
+	v      [4]uint64
+	total  uint64
+	buf    [32]byte
+	buffed int
+}
+
+// NewXXH64 returns an XXH64 hash with seed 0. Sum appends the digest
+// big-endian, matching the hex output of xxhsum -H64.
+func NewXXH64() hash.Hash64 {
+	h := &xxh64{}
+	h.Reset()
+	return h
+}
+
+func (h *xxh64) Reset() {
+	prime1, prime2 := xxhPrime1, xxhPrime2
+	h.v = [4]uint64{prime1 + prime2, prime2, 0, -prime1}
+	h.total = 0
+	h.buffed = 0
+}
+
+func (h *xxh64) Size() int      { return 8 }
+func (h *xxh64) BlockSize() int { return 32 }
+
+func (h *xxh64) Write(p []byte) (int, error) {
+	written := len(p)
+	h.total += uint64(len(p))
+
+	if h.buffed > 0 {
+		n := copy(h.buf[h.buffed:], p)
+		h.buffed += n
+		p = p[n:]
+		if h.buffed < len(h.buf) {
+			return written, nil
+		}
+		h.stripe(h.buf[:])
+		h.buffed = 0
+	}
+
+	for len(p) >= 32 {
+		h.stripe(p[:32])
+		p = p[32:]
+	}
+	h.buffed = copy(h.buf[:], p)
+
+	return written, nil
+}
+
+func (h *xxh64) stripe(p []byte) {
+	for i := range h.v {
+		h.v[i] = xxhRound(h.v[i], binary.LittleEndian.Uint64(p[8*i:]))
+	}
+}
+
+func (h *xxh64) Sum64() uint64 {
+	var acc uint64
+	if h.total >= 32 {
+		v := h.v
+		acc = bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) + bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+		for _, lane := range v {
+			acc ^= xxhRound(0, lane)
+			acc = acc*xxhPrime1 + xxhPrime4
+		}
+	} else {
+		acc = xxhPrime5
+	}
+	acc += h.total
+
+	p := h.buf[:h.buffed]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxhRound(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * xxhPrime1
+		acc = bits.RotateLeft64(acc, 23)*xxhPrime2 + xxhPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		acc ^= uint64(b) * xxhPrime5
+		acc = bits.RotateLeft64(acc, 11) * xxhPrime1
+	}
+
+	acc ^= acc >> 33
+	acc *= xxhPrime2
+	acc ^= acc >> 29
+	acc *= xxhPrime3
+	acc ^= acc >> 32
+
+	return acc
+}
+
+func (h *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, h.Sum64())
+}
+
+func xxhRound(acc uint64, input uint64) uint64 {
+	acc += input * xxhPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxhPrime1
+}
@@ -0,0 +1,91 @@
+package wc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+)
+
+// IOMode selects how regular files are read.
+type IOMode string
+
+const (
+	IOAuto IOMode = "auto"
+	IORead IOMode = "read"
+	IOMmap IOMode = "mmap"
+)
+
+// mmapThreshold is the smallest file IOAuto maps; below it the cost of
+// setting up the mapping outweighs the copy saved by read(2).
+const mmapThreshold = 4 << 20
+
+func ParseIOMode(value string) (IOMode, bool) {
+	mode := IOMode(strings.ToLower(strings.TrimSpace(value)))
+	switch mode {
+	case IOAuto, IORead, IOMmap:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+// shouldMap reports whether file should be counted through a memory mapping.
+// Only non-empty regular files that fit in the address space qualify. The zero
+// IOMode behaves like IOAuto.
+func shouldMap(mode IOMode, file *os.File) (int, bool) {
+	if mode == IORead || !mmapSupported {
+		return 0, false
+	}
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+
+	return mapSize(mode, 0, info.Size())
+}
+
+// mapSize reports how much of a regular file to map for counting length
+// bytes from offset: everything up to the end of the counted bytes, since
+// mappings start at a page boundary.
+func mapSize(mode IOMode, offset int64, length int64) (int, bool) {
+	if mode == IORead || !mmapSupported || length <= 0 {
+		return 0, false
+	}
+
+	size := offset + length
+	if int64(int(size)) != size {
+		return 0, false
+	}
+	if mode != IOMmap && length < mmapThreshold {
+		return 0, false
+	}
+
+	return int(size), true
+}
+
+// countMapped counts file from offset to size through a read-only mapping.
+// It reports false when the mapping cannot be established so the caller can
+// fall back to reading. A file truncated while mapped faults on access; that
+// fault is turned into an error instead of crashing the process.
+func countMapped(ctx context.Context, file *os.File, offset int64, size int, selection CountSelection) (counts Counts, mapped bool, err error) {
+	mapping, err := mmapFile(file, size)
+	if err != nil {
+		return Counts{}, false, nil
+	}
+	defer munmapFile(mapping)
+	data := mapping[offset:]
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			counts = Counts{}
+			err = fmt.Errorf("file changed while mapped: %v", recovered)
+		}
+	}()
+
+	counts, err = countSliceContext(ctx, data, selection)
+	return counts, true, err
+}
@@ -0,0 +1,113 @@
+package wc
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// BinaryPolicy decides what happens to inputs that look binary.
+type BinaryPolicy string
+
+const (
+	// BinaryCount counts binary inputs like any other; the empty policy
+	// behaves the same.
+	BinaryCount BinaryPolicy = "count"
+	// BinarySkip leaves binary inputs out of the counts and the total.
+	BinarySkip BinaryPolicy = "skip"
+	// BinaryReport counts binary inputs and marks their rows.
+	BinaryReport BinaryPolicy = "report"
+)
+
+// binaryReason is the RowStatus reason of binary inputs.
+const binaryReason = "binary"
+
+// sniffSize is how much of an input is inspected to classify it.
+const sniffSize = 8 * 1024
+
+// binaryMagic lists prefixes of common binary formats whose first block may
+// still look like text.
+var binaryMagic = [][]byte{
+	[]byte("\x7fELF"),
+	[]byte("\x89PNG\r\n\x1a\n"),
+	[]byte("GIF87a"),
+	[]byte("GIF89a"),
+	[]byte("\xff\xd8\xff"),
+	[]byte("%PDF-"),
+	[]byte("PK\x03\x04"),
+	[]byte("\x1f\x8b"),
+	[]byte("\x28\xb5\x2f\xfd"),
+	[]byte("\xfd7zXZ\x00"),
+	[]byte("7z\xbc\xaf\x27\x1c"),
+	[]byte("\xca\xfe\xba\xbe"),
+	[]byte("\xcf\xfa\xed\xfe"),
+	[]byte("\xce\xfa\xed\xfe"),
+	[]byte("SQLite format 3\x00"),
+}
+
+func ParseBinaryPolicy(value string) (BinaryPolicy, bool) {
+	policy := BinaryPolicy(strings.ToLower(strings.TrimSpace(value)))
+	switch policy {
+	case BinaryCount, BinarySkip, BinaryReport:
+		return policy, true
+	default:
+		return "", false
+	}
+}
+
+// sniff returns the first block of reader and a reader that still yields the
+// whole input. Seekable readers such as files, standard input redirected from
+// a file, and sliced files are peeked at with ReadAt and returned unchanged,
+// so the size, mmap, and fadvise paths still apply; other readers get the
+// block replayed in front.
+func sniff(reader io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, sniffSize)
+	if file, ok := reader.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		if offset, err := file.Seek(0, io.SeekCurrent); err == nil {
+			n, err := file.ReadAt(head, offset)
+			if err == nil || err == io.EOF {
+				return head[:n], reader, nil
+			}
+		}
+	}
+
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+
+	return head, io.MultiReader(bytes.NewReader(head), reader), nil
+}
+
+// looksBinary classifies an input by its first block: a known magic number,
+// any NUL byte, or more than 30% of the bytes not being valid UTF-8.
+func looksBinary(head []byte) bool {
+	for _, magic := range binaryMagic {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+
+	invalid := 0
+	for p := head; len(p) > 0; {
+		if !utf8.FullRune(p) {
+			// A sequence cut off by the end of the block.
+			break
+		}
+		r, size := utf8.DecodeRune(p)
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		}
+		p = p[size:]
+	}
+
+	return invalid*10 > len(head)*3
+}
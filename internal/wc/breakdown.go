@@ -0,0 +1,144 @@
+package wc
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Breakdown selects how characters are classified for a per-class count.
+type Breakdown string
+
+const (
+	// BreakdownScript counts characters by Unicode script, such as "Latin"
+	// or "Han". Characters shared between scripts, like digits and
+	// punctuation, are "Common"; unassigned code points are "Unknown".
+	BreakdownScript Breakdown = "script"
+	// BreakdownCategory counts characters by general category: "letter",
+	// "mark", "number", "punctuation", "symbol", "space", "control",
+	// "format", and "other".
+	BreakdownCategory Breakdown = "category"
+)
+
+func ParseBreakdown(value string) (Breakdown, bool) {
+	mode := Breakdown(strings.ToLower(strings.TrimSpace(value)))
+	switch mode {
+	case BreakdownScript, BreakdownCategory:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+// scriptNames orders the lookup of scripts outside ASCII, so it does not
+// depend on map iteration.
+var scriptNames = func() []string {
+	names := make([]string, 0, len(unicode.Scripts))
+	for name := range unicode.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}()
+
+// breakdownAccumulator counts the characters -m counts, so invalid bytes are
+// left out and the classes add up to the chars count.
+type breakdownAccumulator struct {
+	mode   Breakdown
+	counts map[string]int
+	// last is the script of the previous character outside ASCII; text in
+	// one script mostly finds it there.
+	last     *unicode.RangeTable
+	lastName string
+}
+
+func newBreakdownAccumulator(mode Breakdown) *breakdownAccumulator {
+	return &breakdownAccumulator{mode: mode, counts: make(map[string]int)}
+}
+
+func (a *breakdownAccumulator) AddRune(unit Unit) {
+	if unit.Invalid {
+		return
+	}
+	if a.mode == BreakdownCategory {
+		a.counts[categoryOf(unit.Rune)]++
+	} else {
+		a.counts[a.scriptOf(unit.Rune)]++
+	}
+}
+
+func (a *breakdownAccumulator) scriptOf(r rune) string {
+	if r < utf8.RuneSelf {
+		if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') {
+			return "Latin"
+		}
+		return "Common"
+	}
+	if a.last != nil && unicode.Is(a.last, r) {
+		return a.lastName
+	}
+	for _, name := range scriptNames {
+		if table := unicode.Scripts[name]; unicode.Is(table, r) {
+			a.last, a.lastName = table, name
+			return name
+		}
+	}
+
+	return "Unknown"
+}
+
+func categoryOf(r rune) string {
+	switch {
+	case unicode.IsLetter(r):
+		return "letter"
+	case unicode.IsMark(r):
+		return "mark"
+	case unicode.IsNumber(r):
+		return "number"
+	case unicode.IsPunct(r):
+		return "punctuation"
+	case unicode.IsSymbol(r):
+		return "symbol"
+	case unicode.In(r, unicode.Z):
+		return "space"
+	case unicode.IsControl(r):
+		return "control"
+	case unicode.In(r, unicode.Cf):
+		return "format"
+	default:
+		return "other"
+	}
+}
+
+// Counts returns a copy of the counts so far.
+func (a *breakdownAccumulator) Counts() map[string]int {
+	counts := make(map[string]int, len(a.counts))
+	for class, n := range a.counts {
+		counts[class] = n
+	}
+	return counts
+}
+
+func addBreakdown(total map[string]int, counts map[string]int) {
+	for class, n := range counts {
+		total[class] += n
+	}
+}
+
+// breakdownClasses orders the classes of counts by count, largest first, then
+// by name.
+func breakdownClasses(counts map[string]int) []string {
+	classes := make([]string, 0, len(counts))
+	for class := range counts {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if counts[classes[i]] != counts[classes[j]] {
+			return counts[classes[i]] > counts[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+
+	return classes
+}
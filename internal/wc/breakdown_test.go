@@ -0,0 +1,93 @@
+package wc_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cc/wcx/internal/wc"
+)
+
+func TestBreakdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  wc.Breakdown
+		input string
+		want  map[string]int
+	}{
+		{name: "empty", mode: wc.BreakdownScript, input: "", want: map[string]int{}},
+		{name: "scripts", mode: wc.BreakdownScript, input: "Hi, мир 你好 مرحبا\u0301", want: map[string]int{
+			"Latin": 2, "Common": 4, "Cyrillic": 3, "Han": 2, "Arabic": 5, "Inherited": 1,
+		}},
+		{name: "unassigned", mode: wc.BreakdownScript, input: "\U000e0080", want: map[string]int{"Unknown": 1}},
+		{name: "categories", mode: wc.BreakdownCategory, input: "Ab1\u0663, \u20ac\u0301\u00a0\t\u200d\ue000", want: map[string]int{
+			"letter": 2, "number": 2, "punctuation": 1, "space": 2, "symbol": 1, "mark": 1, "control": 1, "format": 1, "other": 1,
+		}},
+		{name: "invalid bytes are left out", mode: wc.BreakdownCategory, input: "a\xffb\xc3", want: map[string]int{"letter": 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counts := assertChunkInvariant(t, test.input, wc.CountSelection{Chars: true, Breakdown: test.mode})
+			if !reflect.DeepEqual(counts.Breakdown, test.want) {
+				t.Fatalf("got %v want %v", counts.Breakdown, test.want)
+			}
+			sum := 0
+			for _, n := range counts.Breakdown {
+				sum += n
+			}
+			if sum != counts.Chars {
+				t.Fatalf("breakdown sums to %d, chars %d", sum, counts.Chars)
+			}
+		})
+	}
+}
+
+func TestRunBreakdown(t *testing.T) {
+	files := map[string]string{"en.txt": "Hello world\n", "ru.txt": "Привет\n"}
+	options := wc.RunOptions{Selection: wc.CountSelection{Chars: true, Breakdown: wc.BreakdownScript}, TotalMode: wc.TotalAuto}
+	result, text := runFiles(t, files, options)
+	if want := map[string]int{"Latin": 10, "Common": 3, "Cyrillic": 6}; !reflect.DeepEqual(result.Total.Breakdown, want) {
+		t.Fatalf("total mismatch: got %v want %v", result.Total.Breakdown, want)
+	}
+
+	want := strings.Join([]string{
+		"12 en.txt",
+		"  Latin   10",
+		"  Common   2",
+		"7 ru.txt",
+		"  Cyrillic  6",
+		"  Common    1",
+		"19 total",
+		"  Latin     10",
+		"  Cyrillic   6",
+		"  Common     3",
+	}, "\n")
+	if text != want {
+		t.Fatalf("text output mismatch:\ngot  %q\nwant %q", text, want)
+	}
+
+	options.Format = "json"
+	got, err := wc.Render(result, options)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	document := wc.JSONOutput{
+		Metrics:     []string{"chars"},
+		BreakdownBy: wc.BreakdownScript,
+		Files: []wc.JSONFileResult{
+			{File: "en.txt", Counts: map[string]int{"chars": 12}, Breakdown: map[string]int{"Latin": 10, "Common": 2}},
+			{File: "ru.txt", Counts: map[string]int{"chars": 7}, Breakdown: map[string]int{"Cyrillic": 6, "Common": 1}},
+		},
+		Total:          map[string]int{"chars": 19},
+		TotalBreakdown: map[string]int{"Latin": 10, "Common": 3, "Cyrillic": 6},
+	}
+	raw, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		t.Fatalf("MarshalIndent failed: %v", err)
+	}
+	if got != string(raw) {
+		t.Fatalf("JSON mismatch:\ngot:\n%s\nwant:\n%s", got, raw)
+	}
+}
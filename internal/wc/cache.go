@@ -0,0 +1,235 @@
+package wc
+
+import (
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheVersion changes whenever the file layout or the meaning of cached
+// counts changes; a cache written with another version is discarded.
+const cacheVersion = 2
+
+// racyWindow guards against a file that is modified again within the
+// timestamp granularity of the filesystem right after it was counted: files
+// changed this recently are counted but not cached.
+var racyWindow = 2 * time.Second
+
+// Cache stores per-file counts between runs. An entry is reused only while
+// the file keeps its device, inode, size, modification time, and change time,
+// and only for the same metric selection and word mode. Save keeps only the
+// entries used since OpenCache, so files that are gone or changed and counts
+// no longer asked for do not pile up. A Cache is safe for use by concurrent
+// workers.
+type Cache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// used holds the keys of entries hit or stored since OpenCache.
+	used  map[string]bool
+	dirty bool
+	stats CacheStats
+}
+
+// CacheStats counts cache lookups. Inputs the cache cannot identify, such as
+// standard input or scheme operands, are not looked up and count as neither.
+type CacheStats struct {
+	Hits   int
+	Misses int
+}
+
+type cacheEntry struct {
+	Size       int64
+	ModTime    int64
+	ChangeTime int64
+	Counts     Counts
+	// Binary records whether the file looked binary when it was counted.
+	Binary bool
+}
+
+type cacheFile struct {
+	Version int
+	Entries map[string]cacheEntry
+}
+
+// fileIdentity is what a cache entry is keyed and validated by.
+type fileIdentity struct {
+	key        string
+	size       int64
+	modTime    int64
+	changeTime int64
+}
+
+// OpenCache loads the cache at path. A missing file yields an empty cache,
+// and so does a cache written by another version, which Save replaces. Any
+// other file is left alone: opening it fails.
+func OpenCache(path string) (*Cache, error) {
+	cache := &Cache{path: path, entries: make(map[string]cacheEntry), used: make(map[string]bool)}
+
+	stored, err := readCacheFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.Version == cacheVersion && stored.Entries != nil {
+		cache.entries = stored.Entries
+	}
+
+	return cache, nil
+}
+
+var errNotCache = errors.New("not a wcx cache")
+
+// readCacheFile decodes the cache at path, failing when it is not a regular
+// file holding a wcx cache.
+func readCacheFile(path string) (cacheFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return cacheFile{}, err
+	}
+	defer file.Close()
+
+	var stored cacheFile
+	if info, err := file.Stat(); err != nil {
+		return cacheFile{}, err
+	} else if !info.Mode().IsRegular() {
+		return cacheFile{}, errNotCache
+	}
+	if err := gob.NewDecoder(file).Decode(&stored); err != nil || stored.Version == 0 {
+		return cacheFile{}, errNotCache
+	}
+
+	return stored, nil
+}
+
+// Save writes the cache back if anything changed, dropping the entries that
+// were not used since OpenCache. The file is replaced atomically, so
+// concurrent runs sharing a cache never see a torn file; the last one to
+// finish wins. A file that appeared at the path since OpenCache is only
+// replaced if it is a wcx cache too.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty && len(c.used) == len(c.entries) {
+		return nil
+	}
+	for key := range c.entries {
+		if !c.used[key] {
+			delete(c.entries, key)
+		}
+	}
+
+	dir, base := filepath.Split(c.path)
+	if dir == "" {
+		dir = "."
+	}
+	temp, err := os.CreateTemp(dir, base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err := gob.NewEncoder(temp).Encode(cacheFile{Version: cacheVersion, Entries: c.entries}); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if _, err := readCacheFile(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(temp.Name(), c.path); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
+
+// Stats reports the lookups made so far.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *Cache) lookup(id fileIdentity, selection CountSelection) (counts Counts, binary bool, hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey(id, selection)
+	entry, ok := c.entries[key]
+	if !ok || entry.Size != id.size || entry.ModTime != id.modTime || entry.ChangeTime != id.changeTime {
+		c.stats.Misses++
+		return Counts{}, false, false
+	}
+
+	c.used[key] = true
+	c.stats.Hits++
+	return entry.Counts, entry.Binary, true
+}
+
+func (c *Cache) store(id fileIdentity, selection CountSelection, counts Counts, binary bool) {
+	cutoff := time.Now().Add(-racyWindow).UnixNano()
+	if id.modTime > cutoff || id.changeTime > cutoff {
+		return
+	}
+
+	key := cacheKey(id, selection)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.used[key] = true
+	c.entries[key] = cacheEntry{
+		Size:       id.size,
+		ModTime:    id.modTime,
+		ChangeTime: id.changeTime,
+		Counts:     counts,
+		Binary:     binary,
+	}
+	c.dirty = true
+}
+
+// keyedMetric is implemented by metrics whose name alone does not identify
+// what they count, such as a MatchMetric and its pattern.
+type keyedMetric interface {
+	cacheKey() string
+}
+
+// cacheKey combines the file with everything that changes its counts: the
+// selected metrics, hash, line ending statistics, findings, encoding report,
+// breakdown, line filters, record delimiter, and line breaks, and whether
+// POSIXLY_CORRECT narrows word separators.
+func cacheKey(id fileIdentity, selection CountSelection) string {
+	posix := os.Getenv("POSIXLY_CORRECT") != ""
+	fields := selection.Fields()
+	for i, m := range selection.Selected() {
+		if keyed, ok := m.(keyedMetric); ok {
+			fields[i] += "=" + keyed.cacheKey()
+		}
+	}
+	return id.key + "|" + strings.Join(fields, ",") + "|hash=" + selection.Hash +
+		"|eol=" + strconv.FormatBool(selection.EOL) + "|findings=" + strconv.FormatBool(selection.Findings) +
+		"|encoding=" + strconv.FormatBool(selection.Encoding) + "|breakdown=" + string(selection.Breakdown) +
+		"|where=" + patternKey(selection.WhereLine) + "|wherenot=" + patternKey(selection.WhereNotLine) +
+		"|delimiter=" + strconv.Quote(selection.RecordDelimiter) + "|unicodebreaks=" + strconv.FormatBool(selection.UnicodeLineBreaks) +
+		"|posix=" + strconv.FormatBool(posix)
+}
+
+// patternKey distinguishes no filter from an empty pattern, which keeps
+// every line.
+func patternKey(pattern *regexp.Regexp) string {
+	if pattern == nil {
+		return "-"
+	}
+	return strconv.Quote(pattern.String())
+}
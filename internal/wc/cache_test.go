@@ -0,0 +1,223 @@
+package wc
+
+import (
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestCacheReusesUnchangedFiles(t *testing.T) {
+	saved := racyWindow
+	racyWindow = 0
+	defer func() { racyWindow = saved }()
+
+	dir := t.TempDir()
+	var names []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("one two\n"), 0o644); err != nil {
+			t.Fatalf("unable to write input: %v", err)
+		}
+		names = append(names, path)
+	}
+	cachePath := filepath.Join(dir, "counts.cache")
+
+	run := func(selection CountSelection) (RunResult, CacheStats) {
+		t.Helper()
+		cache, err := OpenCache(cachePath)
+		if err != nil {
+			t.Fatalf("OpenCache failed: %v", err)
+		}
+		inputs, err := ResolveInputs(names, "")
+		if err != nil {
+			t.Fatalf("ResolveInputs failed: %v", err)
+		}
+		result := Run(inputs, RunOptions{Selection: selection, TotalMode: TotalAuto, Jobs: 3, Cache: cache})
+		if err := cache.Save(); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		return result, cache.Stats()
+	}
+
+	if _, stats := run(DefaultSelection()); stats != (CacheStats{Misses: 3}) {
+		t.Fatalf("first run stats: got %+v", stats)
+	}
+	if result, stats := run(DefaultSelection()); stats != (CacheStats{Hits: 3}) || result.Total.Words != 6 {
+		t.Fatalf("second run: got %+v, total %+v", stats, result.Total)
+	}
+
+	if err := os.WriteFile(names[1], []byte("one two three\nfour\n"), 0o644); err != nil {
+		t.Fatalf("unable to rewrite input: %v", err)
+	}
+	result, stats := run(DefaultSelection())
+	if stats != (CacheStats{Hits: 2, Misses: 1}) || result.Rows[1].Counts.Words != 4 || result.Total.Words != 8 {
+		t.Fatalf("run after a change: got %+v, rows %+v", stats, result.Rows)
+	}
+
+	if _, stats := run(CountSelection{Words: true}); stats != (CacheStats{Misses: 3}) {
+		t.Fatalf("another selection must not reuse entries: got %+v", stats)
+	}
+}
+
+func TestCacheSaveDropsUnusedEntries(t *testing.T) {
+	saved := racyWindow
+	racyWindow = 0
+	defer func() { racyWindow = saved }()
+
+	dir := t.TempDir()
+	var names []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("one two\n"), 0o644); err != nil {
+			t.Fatalf("unable to write input: %v", err)
+		}
+		names = append(names, path)
+	}
+	cachePath := filepath.Join(dir, "counts.cache")
+
+	// run counts names with selection and returns how many entries the saved
+	// cache holds.
+	run := func(names []string, selection CountSelection) int {
+		t.Helper()
+		cache, err := OpenCache(cachePath)
+		if err != nil {
+			t.Fatalf("OpenCache failed: %v", err)
+		}
+		inputs, err := ResolveInputs(names, "")
+		if err != nil {
+			t.Fatalf("ResolveInputs failed: %v", err)
+		}
+		Run(inputs, RunOptions{Selection: selection, TotalMode: TotalAuto, Cache: cache})
+		if err := cache.Save(); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		stored, err := readCacheFile(cachePath)
+		if err != nil {
+			t.Fatalf("unable to read saved cache: %v", err)
+		}
+		return len(stored.Entries)
+	}
+
+	if got := run(names, DefaultSelection()); got != 3 {
+		t.Fatalf("first run saved %d entries, want 3", got)
+	}
+	if err := os.Remove(names[2]); err != nil {
+		t.Fatalf("unable to remove input: %v", err)
+	}
+	if got := run(names[:2], DefaultSelection()); got != 2 {
+		t.Fatalf("entry of a deleted file was kept: %d entries", got)
+	}
+	if got := run(names[:2], CountSelection{Words: true}); got != 2 {
+		t.Fatalf("entries of an old selection were kept: %d entries", got)
+	}
+	if err := os.WriteFile(names[0], []byte("changed\n"), 0o644); err != nil {
+		t.Fatalf("unable to rewrite input: %v", err)
+	}
+	if got := run(names[:1], CountSelection{Words: true}); got != 1 {
+		t.Fatalf("unused entries were kept after a change: %d entries", got)
+	}
+}
+
+func TestCacheSkipsRecentlyChangedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fresh.txt")
+	if err := os.WriteFile(path, []byte("x\n"), 0o644); err != nil {
+		t.Fatalf("unable to write input: %v", err)
+	}
+
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "counts.cache"))
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	inputs, err := ResolveInputs([]string{path}, "")
+	if err != nil {
+		t.Fatalf("ResolveInputs failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		Run(inputs, RunOptions{Selection: DefaultSelection(), Cache: cache})
+	}
+
+	if stats := cache.Stats(); stats != (CacheStats{Misses: 2}) {
+		t.Fatalf("a file changed within the racy window must not be cached: got %+v", stats)
+	}
+}
+
+func TestOpenCacheDiscardsOtherVersions(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		contents func(path string) error
+	}{
+		{name: "older version", contents: func(path string) error {
+			file, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			entries := map[string]cacheEntry{"1:2|lines|posix=false": {Counts: Counts{Lines: 9}}}
+			return gob.NewEncoder(file).Encode(cacheFile{Version: cacheVersion - 1, Entries: entries})
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name)
+			if err := test.contents(path); err != nil {
+				t.Fatalf("unable to write cache: %v", err)
+			}
+
+			cache, err := OpenCache(path)
+			if err != nil {
+				t.Fatalf("OpenCache failed: %v", err)
+			}
+			if len(cache.entries) != 0 {
+				t.Fatalf("expected an empty cache, got %+v", cache.entries)
+			}
+		})
+	}
+}
+
+func TestCacheKeyIncludesMatchPatterns(t *testing.T) {
+	id := fileIdentity{key: "1:2"}
+	errors := CountSelection{Extra: []Metric{NewMatchMetric("hits", regexp.MustCompile(`ERROR`), MatchLines)}}
+	warnings := CountSelection{Extra: []Metric{NewMatchMetric("hits", regexp.MustCompile(`WARN`), MatchLines)}}
+	occurrences := CountSelection{Extra: []Metric{NewMatchMetric("hits", regexp.MustCompile(`ERROR`), MatchOccurrences)}}
+
+	if cacheKey(id, errors) == cacheKey(id, warnings) || cacheKey(id, errors) == cacheKey(id, occurrences) {
+		t.Fatalf("match columns of the same name share a cache key: %q", cacheKey(id, errors))
+	}
+}
+
+func TestCacheLeavesOtherFilesAlone(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("not a cache"), 0o644); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if _, err := OpenCache(path); !errors.Is(err, errNotCache) {
+		t.Fatalf("OpenCache of another file: got %v want %v", err, errNotCache)
+	}
+	if _, err := OpenCache(dir); !errors.Is(err, errNotCache) {
+		t.Fatalf("OpenCache of a directory: got %v want %v", err, errNotCache)
+	}
+
+	// A file created at the path after OpenCache is not replaced either.
+	later := filepath.Join(dir, "later.cache")
+	cache, err := OpenCache(later)
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	cache.entries["key"] = cacheEntry{Counts: Counts{Lines: 1}}
+	cache.dirty = true
+	if err := os.WriteFile(later, []byte("precious"), 0o644); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if err := cache.Save(); !errors.Is(err, errNotCache) {
+		t.Fatalf("Save over another file: got %v want %v", err, errNotCache)
+	}
+	if data, _ := os.ReadFile(later); string(data) != "precious" {
+		t.Fatalf("Save replaced the file: %q", data)
+	}
+}
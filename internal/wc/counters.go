@@ -1,10 +1,13 @@
 package wc
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"encoding/hex"
+	"hash"
 	"io"
 	"os"
+	"sort"
 	"unicode"
 	"unicode/utf8"
 )
@@ -15,6 +18,20 @@ type Counts struct {
 	Chars         int `json:"chars"`
 	Bytes         int `json:"bytes"`
 	MaxLineLength int `json:"maxLineLength"`
+	// Extra holds the values of selected custom metrics, keyed by name.
+	Extra map[string]int `json:"extra,omitempty"`
+	// Hash is the hex digest of the content when CountSelection.Hash is set.
+	Hash string `json:"hash,omitempty"`
+	// EOL holds line ending statistics when CountSelection.EOL is set.
+	EOL *EOLStats `json:"eol,omitempty"`
+	// Findings lists the lines flagged by the selected metrics, by line, when
+	// CountSelection.Findings is set.
+	Findings []Finding `json:"findings,omitempty"`
+	// Encoding reports on UTF-8 validity when CountSelection.Encoding is set.
+	Encoding *EncodingReport `json:"encoding,omitempty"`
+	// Breakdown counts characters by class when CountSelection.Breakdown is
+	// set.
+	Breakdown map[string]int `json:"breakdown,omitempty"`
 }
 
 func CountAll(values []byte) Counts {
@@ -51,79 +68,421 @@ func CountMaxLineLength(values []byte) int {
 	return counts.MaxLineLength
 }
 
+// countChunkSize is both the read buffer size and how much of an in-memory
+// input is counted between cancellation checks.
+const countChunkSize = 64 * 1024
+
 // CountReader computes all requested metrics in one pass over reader.
 // Invalid UTF-8 bytes are counted as bytes, treated as non-whitespace for
 // words, skipped for chars, and contribute zero display width.
 func CountReader(reader io.Reader, selection CountSelection) (Counts, error) {
-	if selection.Bytes && !selection.Lines && !selection.Words && !selection.Chars && !selection.MaxLineLength {
-		size, err := io.Copy(io.Discard, reader)
-		if err != nil {
+	return CountReaderContext(context.Background(), reader, selection)
+}
+
+// CountReaderContext is CountReader that gives up with ctx.Err() between
+// reads once ctx is done.
+func CountReaderContext(ctx context.Context, reader io.Reader, selection CountSelection) (Counts, error) {
+	c := NewCounter(selection)
+	if _, err := c.ReadFrom(contextReader{ctx: ctx, reader: reader}); err != nil {
+		return Counts{}, err
+	}
+	_ = c.Close()
+
+	return c.Counts(), nil
+}
+
+// countSliceContext counts data that is already in memory, such as a mapped
+// file, checking ctx between chunks.
+func countSliceContext(ctx context.Context, data []byte, selection CountSelection) (Counts, error) {
+	c := NewCounter(selection)
+	for len(data) > 0 {
+		if err := ctx.Err(); err != nil {
 			return Counts{}, err
 		}
-		return Counts{Bytes: int(size)}, nil
+		chunk := data[:min(len(data), countChunkSize)]
+		_, _ = c.Write(chunk)
+		data = data[len(chunk):]
 	}
+	_ = c.Close()
 
-	counts := Counts{}
-	inWord := false
-	currentLineWidth := 0
-	posixMode := os.Getenv("POSIXLY_CORRECT") != ""
+	return c.Counts(), nil
+}
+
+// contextReader fails reads once ctx is done, so long inputs can be abandoned
+// mid-stream.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
 
-	buf := bufio.NewReaderSize(reader, 64*1024)
+	return r.reader.Read(p)
+}
+
+// Counter accumulates counts over data delivered in arbitrary chunks, keeping
+// the state of every selected metric across calls. A UTF-8 sequence split
+// across chunk boundaries is carried over until the rest of it arrives.
+// Create one with NewCounter; a Counter is not safe for concurrent use.
+type Counter struct {
+	selection    CountSelection
+	metrics      []Metric
+	accumulators []Accumulator
+	runes        []RuneAccumulator
+	chunks       []ChunkAccumulator
+	digest       hash.Hash
+	eol          *eolAccumulator
+	findings     []FindingAccumulator
+	encoding     *encodingAccumulator
+	breakdown    *breakdownAccumulator
+	pending      [utf8.UTFMax]byte
+	pendingLen   int
+
+	// filtering is set when CountSelection.WhereLine or WhereNotLine is;
+	// line then holds the unterminated line so far, and keptLines maps the
+	// kept lines to their place in the input for findings and encoding
+	// errors.
+	filtering bool
+	delimiter byte
+	line      []byte
+	lineNo    int
+	offset    int64
+	kept      int64
+	keptLines []keptLine
+}
+
+// keptLine locates a line that passed the filter: its number and offset in
+// the input, and its offset among the kept lines.
+type keptLine struct {
+	line       int
+	offset     int64
+	keptOffset int64
+}
+
+var (
+	_ io.WriteCloser = (*Counter)(nil)
+	_ io.ReaderFrom  = (*Counter)(nil)
+)
+
+func NewCounter(selection CountSelection) *Counter {
+	c := &Counter{selection: selection, metrics: selection.Selected()}
+	c.Reset()
+	return c
+}
+
+// Write counts p. It never fails and always consumes all of p. With a line
+// filter, a line is counted once its delimiter arrives.
+func (c *Counter) Write(p []byte) (int, error) {
+	if c.encoding != nil {
+		c.encoding.AddChunk(p)
+	}
+	if !c.filtering {
+		return c.count(p)
+	}
+
+	written := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, c.delimiter)
+		if i < 0 {
+			c.line = append(c.line, p...)
+			break
+		}
+		line := p[:i+1]
+		if len(c.line) > 0 {
+			c.line = append(c.line, line...)
+			line = c.line
+		}
+		c.countLine(line)
+		c.line = c.line[:0]
+		p = p[i+1:]
+	}
+
+	return written, nil
+}
+
+// countLine counts line, delimiter included, if it passes the filter.
+func (c *Counter) countLine(line []byte) {
+	c.lineNo++
+	offset := c.offset
+	c.offset += int64(len(line))
+	text := bytes.TrimSuffix(line, []byte{c.delimiter})
+	if where := c.selection.WhereLine; where != nil && !where.Match(text) {
+		return
+	}
+	if whereNot := c.selection.WhereNotLine; whereNot != nil && whereNot.Match(text) {
+		return
+	}
+
+	if c.selection.Findings || c.selection.Encoding {
+		c.keptLines = append(c.keptLines, keptLine{line: c.lineNo, offset: offset, keptOffset: c.kept})
+	}
+	c.kept += int64(len(line))
+	_, _ = c.count(line)
+}
+
+func (c *Counter) count(p []byte) (int, error) {
+	written := len(p)
+	for _, acc := range c.chunks {
+		acc.AddChunk(p)
+	}
+	if c.digest != nil {
+		_, _ = c.digest.Write(p)
+	}
+	if c.eol != nil {
+		c.eol.AddChunk(p)
+	}
+	if len(c.runes) == 0 && c.encoding == nil && c.breakdown == nil {
+		return written, nil
+	}
+
+	if c.pendingLen > 0 {
+		// Join the carried-over prefix with enough new bytes to finish it.
+		var joined [2 * utf8.UTFMax]byte
+		carried := copy(joined[:], c.pending[:c.pendingLen])
+		added := copy(joined[carried:], p)
+		buf := joined[:carried+added]
+
+		offset := 0
+		for offset < carried {
+			if !utf8.FullRune(buf[offset:]) {
+				c.pendingLen = copy(c.pending[:], buf[offset:])
+				return written, nil
+			}
+			unit := decodeUnit(buf[offset:])
+			c.observe(unit)
+			offset += unit.Size
+		}
+		c.pendingLen = 0
+		p = p[offset-carried:]
+	}
+
+	for len(p) > 0 {
+		if p[0] < utf8.RuneSelf {
+			c.observe(Unit{Rune: rune(p[0]), Size: 1})
+			p = p[1:]
+			continue
+		}
+		if !utf8.FullRune(p) {
+			c.pendingLen = copy(c.pending[:], p)
+			return written, nil
+		}
+		unit := decodeUnit(p)
+		c.observe(unit)
+		p = p[unit.Size:]
+	}
+
+	return written, nil
+}
+
+// ReadFrom counts everything reader yields until EOF.
+func (c *Counter) ReadFrom(reader io.Reader) (int64, error) {
+	buf := make([]byte, countChunkSize)
+	total := int64(0)
 	for {
-		r, size, err := buf.ReadRune()
+		n, err := reader.Read(buf)
+		_, _ = c.Write(buf[:n])
+		total += int64(n)
 		if err == io.EOF {
-			break
+			return total, nil
 		}
 		if err != nil {
-			return Counts{}, err
+			return total, err
 		}
+	}
+}
 
-		if selection.Bytes {
-			counts.Bytes += size
-		}
+// Close marks the end of the input: an incomplete trailing UTF-8 sequence is
+// counted as invalid bytes, and an unterminated last line is filtered.
+// Writing after Close starts a new sequence but otherwise continues the same
+// counts. Close never fails.
+func (c *Counter) Close() error {
+	if len(c.line) > 0 {
+		c.countLine(c.line)
+		c.line = c.line[:0]
+	}
 
-		isEncodingError := r == utf8.RuneError && size == 1
+	rest := c.pending[:c.pendingLen]
+	for len(rest) > 0 {
+		unit := decodeUnit(rest)
+		c.observe(unit)
+		rest = rest[unit.Size:]
+	}
+	c.pendingLen = 0
+
+	return nil
+}
 
-		if selection.Lines && r == '\n' {
-			counts.Lines++
+// Counts returns the counts for everything written so far. Bytes of an
+// incomplete trailing UTF-8 sequence are included in the byte count, but
+// rune-based metrics see them only once the sequence is completed or Close
+// is called.
+func (c *Counter) Counts() Counts {
+	counts := Counts{}
+	for i, m := range c.metrics {
+		setMetricValue(&counts, m, c.accumulators[i].Value())
+	}
+	if c.digest != nil {
+		counts.Hash = hex.EncodeToString(c.digest.Sum(nil))
+	}
+	if c.eol != nil {
+		stats := c.eol.Stats()
+		counts.EOL = &stats
+	}
+	if c.selection.Findings {
+		counts.Findings = c.collectFindings()
+	}
+	if c.encoding != nil {
+		report := c.encoding.Report()
+		if c.filtering {
+			c.locateInInput(report.Errors)
 		}
+		counts.Encoding = &report
+	}
+	if c.breakdown != nil {
+		counts.Breakdown = c.breakdown.Counts()
+	}
 
-		if selection.MaxLineLength {
-			switch r {
-			case '\n':
-				if currentLineWidth > counts.MaxLineLength {
-					counts.MaxLineLength = currentLineWidth
-				}
-				currentLineWidth = 0
-			case '\t':
-				currentLineWidth += 8 - (currentLineWidth % 8)
-			default:
-				if !isEncodingError {
-					currentLineWidth += runeDisplayWidth(r)
-				}
-			}
+	return counts
+}
+
+// Reset clears all state so the Counter can be reused for another input.
+func (c *Counter) Reset() {
+	c.accumulators = make([]Accumulator, 0, len(c.metrics))
+	c.runes = c.runes[:0]
+	c.chunks = c.chunks[:0]
+	c.findings = make([]FindingAccumulator, len(c.metrics))
+	for i, m := range c.metrics {
+		acc := m.NewAccumulator()
+		c.accumulators = append(c.accumulators, acc)
+		if finder, ok := acc.(FindingAccumulator); ok && c.selection.Findings {
+			finder.RecordFindings()
+			c.findings[i] = finder
+		}
+		if runes, ok := acc.(RuneAccumulator); ok {
+			c.runes = append(c.runes, runes)
+		}
+		if chunks, ok := acc.(ChunkAccumulator); ok {
+			c.chunks = append(c.chunks, chunks)
 		}
+	}
+	c.digest = newHash(c.selection.Hash)
+	c.eol = nil
+	if c.selection.EOL {
+		c.eol = newEOLAccumulator()
+	}
+	c.encoding = nil
+	if c.selection.Encoding {
+		c.encoding = newEncodingAccumulator(c.selection.delimiter())
+	}
+	c.breakdown = nil
+	if c.selection.Breakdown != "" {
+		c.breakdown = newBreakdownAccumulator(c.selection.Breakdown)
+	}
+	c.pendingLen = 0
+	c.filtering = c.selection.WhereLine != nil || c.selection.WhereNotLine != nil
+	c.delimiter = c.selection.delimiter()
+	c.line = c.line[:0]
+	c.lineNo = 0
+	c.offset, c.kept = 0, 0
+	c.keptLines = nil
+}
 
-		if selection.Chars && !isEncodingError {
-			counts.Chars++
+// locateInInput maps errors found among the kept lines to their place in
+// the input. Lines are kept whole, so columns stay the same.
+func (c *Counter) locateInInput(errors []EncodingError) {
+	for i, e := range errors {
+		if e.Line > len(c.keptLines) {
+			continue
 		}
+		kept := c.keptLines[e.Line-1]
+		errors[i].Line = kept.line
+		errors[i].Offset = kept.offset + e.Offset - kept.keptOffset
+	}
+}
 
-		if selection.Words {
-			isWhitespace := !isEncodingError && IsWhitespace(r, posixMode)
-			if isWhitespace {
-				inWord = false
-			} else if !inWord {
-				counts.Words++
-				inWord = true
+// collectFindings merges the findings of every metric in line order; lines
+// flagged by several metrics keep the selection order. Under a line filter
+// the metrics number the kept lines, which are mapped back to the input.
+func (c *Counter) collectFindings() []Finding {
+	var findings []Finding
+	for i, finder := range c.findings {
+		if finder == nil {
+			continue
+		}
+		for _, line := range finder.Findings() {
+			if c.filtering && line <= len(c.keptLines) {
+				line = c.keptLines[line-1].line
 			}
+			findings = append(findings, Finding{Line: line, Metric: c.metrics[i].Name()})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+
+	return findings
+}
+
+func (c *Counter) observe(unit Unit) {
+	for _, acc := range c.runes {
+		acc.AddRune(unit)
+	}
+	if c.encoding != nil {
+		c.encoding.AddRune(unit)
+	}
+	if c.breakdown != nil {
+		c.breakdown.AddRune(unit)
+	}
+}
+
+// sizedFile is the subset of *os.File that byte counting needs to avoid
+// reading regular files.
+type sizedFile interface {
+	io.Reader
+	io.Seeker
+	Stat() (os.FileInfo, error)
+}
+
+// countBytesBySize follows GNU wc: a regular file's size comes from fstat and
+// the data is skipped with a seek relative to the current offset, so stdin
+// redirected from a partly consumed file is measured correctly. Sizes that are
+// a multiple of the page size may come from pseudo-files (/proc, /sys) that
+// misreport st_size, so only the bulk below the last block is skipped and the
+// remainder is read. Any stat or seek failure falls back to reading the stream.
+func countBytesBySize(file sizedFile) (int64, error) {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return io.Copy(io.Discard, file)
+	}
+
+	current, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return io.Copy(io.Discard, file)
+	}
+
+	end := info.Size()
+	pageSize := int64(os.Getpagesize())
+	if end%pageSize != 0 {
+		if current >= end {
+			return 0, nil
+		}
+		if _, err := file.Seek(end, io.SeekStart); err == nil {
+			return end - current, nil
 		}
+		return io.Copy(io.Discard, file)
 	}
 
-	if selection.MaxLineLength && currentLineWidth > counts.MaxLineLength {
-		counts.MaxLineLength = currentLineWidth
+	skipped := int64(0)
+	highPos := end - end%(pageSize+1)
+	if current < highPos {
+		if _, err := file.Seek(highPos, io.SeekStart); err == nil {
+			skipped = highPos - current
+		}
 	}
 
-	return counts, nil
+	rest, err := io.Copy(io.Discard, file)
+	return skipped + rest, err
 }
 
 // IsWhitespace follows GNU wc behavior: in non-POSIX mode it also treats
@@ -2,6 +2,9 @@ package wc
 
 import (
 	"bytes"
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -17,3 +20,25 @@ func BenchmarkCountReader(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkInputBackend(b *testing.B) {
+	line := []byte("Lorem ipsum dolor sit amet, consectetur adipiscing elit.\n")
+	path := filepath.Join(b.TempDir(), "input.txt")
+	if err := os.WriteFile(path, bytes.Repeat(line, 200_000), 0o644); err != nil {
+		b.Fatalf("unable to write benchmark input: %v", err)
+	}
+
+	input := InputSource{Path: path, DisplayName: path}
+	selection := CountSelection{Lines: true, Words: true, Chars: true, Bytes: true, MaxLineLength: true}
+
+	for _, mode := range []IOMode{IORead, IOMmap} {
+		b.Run(string(mode), func(b *testing.B) {
+			options := RunOptions{Selection: selection, IO: mode}
+			for i := 0; i < b.N; i++ {
+				if row := processInput(context.Background(), input, options); row.Error != nil {
+					b.Fatalf("processInput failed: %v", row.Error)
+				}
+			}
+		})
+	}
+}
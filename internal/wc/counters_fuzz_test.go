@@ -2,7 +2,9 @@ package wc
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
+	"testing/iotest"
 )
 
 func FuzzCountReader(f *testing.F) {
@@ -29,5 +31,13 @@ func FuzzCountReader(f *testing.F) {
 		if counts.Lines > counts.Bytes {
 			t.Fatalf("lines cannot exceed bytes: %+v", counts)
 		}
+
+		chunked, err := CountReader(iotest.OneByteReader(bytes.NewReader(input)), selection)
+		if err != nil {
+			t.Fatalf("CountReader returned unexpected error for chunked input: %v", err)
+		}
+		if !reflect.DeepEqual(chunked, counts) {
+			t.Fatalf("chunk boundaries changed counts: got %+v want %+v", chunked, counts)
+		}
 	})
 }
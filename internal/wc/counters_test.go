@@ -1,6 +1,15 @@
 package wc_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 
 	"cc/wcx/internal/wc"
@@ -73,3 +82,292 @@ func TestCounterEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+// cancellingReader cancels its context after handing out the first chunk.
+type cancellingReader struct {
+	cancel context.CancelFunc
+	reader io.Reader
+}
+
+func (r cancellingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p[:min(len(p), 16)])
+	r.cancel()
+	return n, err
+}
+
+func TestCountReaderContextStopsMidStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := cancellingReader{cancel: cancel, reader: bytes.NewReader(bytes.Repeat([]byte("word "), 1000))}
+	_, err := wc.CountReaderContext(ctx, reader, wc.DefaultSelection())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// assertChunkInvariant checks that input written to a Counter in two pieces,
+// split at every point, counts the same as in one write, and returns those
+// counts.
+func assertChunkInvariant(t *testing.T, input string, selection wc.CountSelection) wc.Counts {
+	t.Helper()
+	counter := wc.NewCounter(selection)
+	_, _ = counter.Write([]byte(input))
+	_ = counter.Close()
+	want := counter.Counts()
+
+	for split := 1; split < len(input); split++ {
+		counter := wc.NewCounter(selection)
+		_, _ = counter.Write([]byte(input[:split]))
+		_, _ = counter.Write([]byte(input[split:]))
+		_ = counter.Close()
+		if got := counter.Counts(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("split at %d: got %+v want %+v", split, got, want)
+		}
+	}
+
+	return want
+}
+
+func TestCounterChunkBoundaries(t *testing.T) {
+	input := []byte("héllo wörld\t🙂 wide\nsecond line\xff\n")
+	selection := wc.CountSelection{Lines: true, Words: true, Chars: true, Bytes: true, MaxLineLength: true}
+	want, err := wc.CountReader(bytes.NewReader(input), selection)
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+
+	for split := 0; split <= len(input); split++ {
+		counter := wc.NewCounter(selection)
+		if _, err := counter.Write(input[:split]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		snapshot := counter.Counts()
+		if snapshot.Bytes != split {
+			t.Fatalf("split %d: snapshot byte count mismatch: got %d", split, snapshot.Bytes)
+		}
+		if _, err := counter.ReadFrom(bytes.NewReader(input[split:])); err != nil {
+			t.Fatalf("ReadFrom failed: %v", err)
+		}
+		if got := counter.Counts(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("split %d: counts mismatch: got %+v want %+v", split, got, want)
+		}
+	}
+
+	counter := wc.NewCounter(selection)
+	_, _ = counter.Write(input)
+	counter.Reset()
+	if got := counter.Counts(); !reflect.DeepEqual(got, wc.Counts{}) {
+		t.Fatalf("Reset left counts behind: %+v", got)
+	}
+}
+
+func TestCounterLineFilter(t *testing.T) {
+	input := "# header\ncode line\n  # note\nhttps://example.com/x\nlast words"
+	tests := []struct {
+		name     string
+		where    string
+		whereNot string
+		kept     string
+	}{
+		{name: "where", where: `^\s*#`, kept: "# header\n  # note\n"},
+		{name: "where not", whereNot: `^\s*#`, kept: "code line\nhttps://example.com/x\nlast words"},
+		{name: "both", where: `\w`, whereNot: `https?://`, kept: "# header\ncode line\n  # note\nlast words"},
+		{name: "anchors at line ends", where: `words$`, kept: "last words"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selection := wc.CountSelection{Lines: true, Words: true, Chars: true, Bytes: true, MaxLineLength: true}
+			want, err := wc.CountReader(strings.NewReader(test.kept), selection)
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if test.where != "" {
+				selection.WhereLine = regexp.MustCompile(test.where)
+			}
+			if test.whereNot != "" {
+				selection.WhereNotLine = regexp.MustCompile(test.whereNot)
+			}
+
+			for split := 0; split <= len(input); split++ {
+				counter := wc.NewCounter(selection)
+				_, _ = counter.Write([]byte(input[:split]))
+				_, _ = counter.Write([]byte(input[split:]))
+				_ = counter.Close()
+				if got := counter.Counts(); !reflect.DeepEqual(got, want) {
+					t.Fatalf("split %d: counts mismatch: got %+v want %+v", split, got, want)
+				}
+			}
+
+			// Byte counts of files must not come from their size.
+			path := filepath.Join(t.TempDir(), "input.txt")
+			if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+				t.Fatalf("unable to write input: %v", err)
+			}
+			bytesOnly := wc.CountSelection{Bytes: true, WhereLine: selection.WhereLine, WhereNotLine: selection.WhereNotLine}
+			result := wc.Run([]wc.InputSource{{Path: path, DisplayName: path}}, wc.RunOptions{Selection: bytesOnly, TotalMode: wc.TotalNever})
+			if got := result.Rows[0].Counts.Bytes; got != len(test.kept) {
+				t.Fatalf("file byte count mismatch: got %d want %d", got, len(test.kept))
+			}
+		})
+	}
+}
+
+func TestCounterLineFilterEncodingErrors(t *testing.T) {
+	for _, delimiter := range []string{"", "\x00"} {
+		d := "\n"
+		if delimiter != "" {
+			d = delimiter
+		}
+		selection := wc.CountSelection{Lines: true, Encoding: true, WhereNotLine: regexp.MustCompile(`^#`), RecordDelimiter: delimiter}
+		input := "# \xff skipped" + d + "ok" + d + "# skipped" + d + "ab\xffc" + d
+		want := &wc.EncodingReport{InvalidSequences: 1, InvalidBytes: 1, Errors: []wc.EncodingError{{Offset: 27, Line: 4, Column: 3}}}
+
+		for split := 0; split <= len(input); split++ {
+			counter := wc.NewCounter(selection)
+			_, _ = counter.Write([]byte(input[:split]))
+			_, _ = counter.Write([]byte(input[split:]))
+			_ = counter.Close()
+			if got := counter.Counts().Encoding; !reflect.DeepEqual(got, want) {
+				t.Fatalf("delimiter %q, split %d: got %+v want %+v", d, split, got, want)
+			}
+		}
+	}
+}
+
+func TestCounterRecordDelimiter(t *testing.T) {
+	tests := []struct {
+		name      string
+		delimiter string
+		input     string
+		want      wc.Counts
+	}{
+		{name: "nul", delimiter: "\x00", input: "dir\x00dir/a b\x00dir/new\nline\x00", want: wc.Counts{Lines: 3, Words: 5, Bytes: 25, MaxLineLength: 11}},
+		{name: "semicolon", delimiter: ";", input: "a;bb;ccc", want: wc.Counts{Lines: 2, Words: 3, Bytes: 8, MaxLineLength: 3}},
+		{name: "record separator", delimiter: "\x1e", input: "one\x1etwo two\x1e", want: wc.Counts{Lines: 2, Words: 3, Bytes: 12, MaxLineLength: 7}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selection := wc.CountSelection{Lines: true, Words: true, Bytes: true, MaxLineLength: true, RecordDelimiter: test.delimiter}
+			for split := 0; split <= len(test.input); split++ {
+				counter := wc.NewCounter(selection)
+				_, _ = counter.Write([]byte(test.input[:split]))
+				_, _ = counter.Write([]byte(test.input[split:]))
+				_ = counter.Close()
+				if got := counter.Counts(); !reflect.DeepEqual(got, test.want) {
+					t.Fatalf("split %d: counts mismatch: got %+v want %+v", split, got, test.want)
+				}
+			}
+		})
+	}
+
+	// Line filters match whole records.
+	selection := wc.CountSelection{Lines: true, Bytes: true, RecordDelimiter: "\x00", WhereNotLine: regexp.MustCompile(`\.git/`)}
+	counts, err := wc.CountReader(strings.NewReader("a.go\x00.git/HEAD\x00b\nc.go\x00"), selection)
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if want := (wc.Counts{Lines: 2, Bytes: 12}); !reflect.DeepEqual(counts, want) {
+		t.Fatalf("filtered counts mismatch: got %+v want %+v", counts, want)
+	}
+}
+
+func TestCounterRecordDelimiterLineMetrics(t *testing.T) {
+	trailing, _ := wc.LookupMetric("trailingWhitespace")
+	selection := wc.CountSelection{
+		Lines:           true,
+		Extra:           []wc.Metric{wc.NewMatchMetric("hits", regexp.MustCompile(`^b`), wc.MatchLines), trailing},
+		Findings:        true,
+		WhereNotLine:    regexp.MustCompile(`^skip`),
+		RecordDelimiter: "\x00",
+	}
+	// The third record holds a newline, which does not end it.
+	input := "a \x00skip\x00b\nx\x00b \x00"
+	want := wc.Counts{
+		Lines: 3,
+		Extra: map[string]int{"hits": 2, "trailingWhitespace": 2},
+		Findings: []wc.Finding{
+			{Line: 1, Metric: "trailingWhitespace"},
+			{Line: 3, Metric: "hits"},
+			{Line: 4, Metric: "hits"},
+			{Line: 4, Metric: "trailingWhitespace"},
+		},
+	}
+
+	for split := 0; split <= len(input); split++ {
+		counter := wc.NewCounter(selection)
+		_, _ = counter.Write([]byte(input[:split]))
+		_, _ = counter.Write([]byte(input[split:]))
+		_ = counter.Close()
+		if got := counter.Counts(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("split %d: counts mismatch: got %+v want %+v", split, got, want)
+		}
+	}
+}
+
+func TestParseRecordDelimiter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   string
+		wantOK bool
+	}{
+		{value: ";", want: ";", wantOK: true},
+		{value: `\0`, want: "\x00", wantOK: true},
+		{value: `\t`, want: "\t", wantOK: true},
+		{value: `\x1e`, want: "\x1e", wantOK: true},
+		{value: "\x00", want: "\x00", wantOK: true},
+		{value: ""},
+		{value: ";;"},
+		{value: `\xff`},
+		{value: "é"},
+		{value: `\q`},
+	}
+
+	for _, test := range tests {
+		got, ok := wc.ParseRecordDelimiter(test.value)
+		if got != test.want || ok != test.wantOK {
+			t.Fatalf("ParseRecordDelimiter(%q): got %q, %v want %q, %v", test.value, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestCounterUnicodeLineBreaks(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  wc.Counts
+	}{
+		{name: "classic mac", input: "one\rtwo\rthree\r", want: wc.Counts{Lines: 3, MaxLineLength: 5}},
+		{name: "crlf counts once", input: "one\r\ntwo\r\n\r\n", want: wc.Counts{Lines: 3, MaxLineLength: 3}},
+		{name: "separators", input: "para one\u2029line\u2028two\u0085three", want: wc.Counts{Lines: 3, MaxLineLength: 8}},
+		{name: "vertical tab and form feed", input: "a\vbb\fccc\n", want: wc.Counts{Lines: 3, MaxLineLength: 3}},
+		{name: "invalid bytes are not breaks", input: "a\x85b\xe2\x80c", want: wc.Counts{Lines: 0, MaxLineLength: 3}},
+	}
+
+	selection := wc.CountSelection{Lines: true, MaxLineLength: true, UnicodeLineBreaks: true}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for split := 0; split <= len(test.input); split++ {
+				counter := wc.NewCounter(selection)
+				_, _ = counter.Write([]byte(test.input[:split]))
+				_, _ = counter.Write([]byte(test.input[split:]))
+				_ = counter.Close()
+				if got := counter.Counts(); !reflect.DeepEqual(got, test.want) {
+					t.Fatalf("split %d: counts mismatch: got %+v want %+v", split, got, test.want)
+				}
+			}
+		})
+	}
+
+	// A record delimiter takes precedence.
+	selection.RecordDelimiter = ";"
+	counts, err := wc.CountReader(strings.NewReader("a\rb;c\u2028d;"), selection)
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if want := (wc.Counts{Lines: 2, MaxLineLength: 3}); !reflect.DeepEqual(counts, want) {
+		t.Fatalf("delimited counts mismatch: got %+v want %+v", counts, want)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package wc
+
+import (
+	"errors"
+	"runtime"
+)
+
+func dupDescriptor(int) (uintptr, error) {
+	return 0, errors.New("file descriptors cannot be duplicated on " + runtime.GOOS)
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package wc
+
+import "syscall"
+
+// dupDescriptor returns a close-on-exec copy of fd, which can be closed
+// without closing fd itself.
+func dupDescriptor(fd int) (uintptr, error) {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+
+	dup, err := syscall.Dup(fd)
+	if err != nil {
+		return 0, err
+	}
+	syscall.CloseOnExec(dup)
+
+	return uintptr(dup), nil
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package wc
+
+import "syscall"
+
+// dupDescriptor returns a copy of the handle fd, which can be closed without
+// closing fd itself.
+func dupDescriptor(fd int) (uintptr, error) {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, err
+	}
+
+	var dup syscall.Handle
+	if err := syscall.DuplicateHandle(process, syscall.Handle(fd), process, &dup, 0, false, syscall.DUPLICATE_SAME_ACCESS); err != nil {
+		return 0, err
+	}
+
+	return uintptr(dup), nil
+}
@@ -0,0 +1,134 @@
+package wc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// maxEncodingErrors is how many invalid sequences an EncodingReport locates.
+const maxEncodingErrors = 5
+
+// EncodingReport describes how well an input conforms to UTF-8.
+type EncodingReport struct {
+	// BOM names the byte order mark the input starts with, also under a
+	// slice or line filter: "utf-8", "utf-16le", "utf-16be", "utf-32le", or
+	// "utf-32be".
+	BOM string `json:"bom,omitempty"`
+	// InvalidSequences counts runs of bytes that are not valid UTF-8, and
+	// InvalidBytes the bytes in them.
+	InvalidSequences int `json:"invalidSequences"`
+	InvalidBytes     int `json:"invalidBytes"`
+	// Errors locates the first few invalid sequences.
+	Errors []EncodingError `json:"errors,omitempty"`
+}
+
+// EncodingError locates an invalid sequence in the input, also under a line
+// filter. Line and Column are 1-based; lines end at
+// CountSelection.RecordDelimiter, and Column counts characters, with each
+// invalid byte as one.
+type EncodingError struct {
+	Offset int64 `json:"offset"`
+	Line   int   `json:"line"`
+	Column int   `json:"column"`
+}
+
+// Check reports a byte order mark other than UTF-8's and any invalid
+// sequence.
+func (r EncodingReport) Check() error {
+	if r.BOM != "" && r.BOM != "utf-8" {
+		return fmt.Errorf("not UTF-8: %s byte order mark", r.BOM)
+	}
+	if r.InvalidSequences > 0 {
+		first := r.Errors[0]
+		message := fmt.Sprintf("invalid UTF-8 at line %d, column %d (byte %d)", first.Line, first.Column, first.Offset)
+		if more := r.InvalidSequences - 1; more > 0 {
+			message += fmt.Sprintf(" and %d more", more)
+		}
+		return errors.New(message)
+	}
+
+	return nil
+}
+
+func (r *EncodingReport) add(other EncodingReport) {
+	r.InvalidSequences += other.InvalidSequences
+	r.InvalidBytes += other.InvalidBytes
+}
+
+// byteOrderMarks is checked in order, so UTF-32LE wins over the UTF-16LE mark
+// it starts with.
+var byteOrderMarks = []struct {
+	name string
+	mark []byte
+}{
+	{name: "utf-8", mark: []byte{0xef, 0xbb, 0xbf}},
+	{name: "utf-32le", mark: []byte{0xff, 0xfe, 0x00, 0x00}},
+	{name: "utf-32be", mark: []byte{0x00, 0x00, 0xfe, 0xff}},
+	{name: "utf-16le", mark: []byte{0xff, 0xfe}},
+	{name: "utf-16be", mark: []byte{0xfe, 0xff}},
+}
+
+// byteOrderMark names the byte order mark head starts with, or returns "".
+func byteOrderMark(head []byte) string {
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(head, bom.mark) {
+			return bom.name
+		}
+	}
+
+	return ""
+}
+
+// encodingAccumulator sees both the raw start of the input, for the byte
+// order mark, and every decoded rune, for invalid sequences. The Counter
+// passes it the input before any line filter.
+type encodingAccumulator struct {
+	delimiter rune
+	report    EncodingReport
+	head      []byte
+	offset    int64
+	line      int
+	column    int
+	inInvalid bool
+}
+
+func newEncodingAccumulator(delimiter byte) *encodingAccumulator {
+	return &encodingAccumulator{delimiter: rune(delimiter), line: 1, column: 1}
+}
+
+func (a *encodingAccumulator) AddChunk(p []byte) {
+	if need := 4 - len(a.head); need > 0 {
+		a.head = append(a.head, p[:min(need, len(p))]...)
+	}
+}
+
+func (a *encodingAccumulator) AddRune(unit Unit) {
+	if unit.Invalid {
+		a.report.InvalidBytes++
+		if !a.inInvalid {
+			a.report.InvalidSequences++
+			if len(a.report.Errors) < maxEncodingErrors {
+				a.report.Errors = append(a.report.Errors, EncodingError{Offset: a.offset, Line: a.line, Column: a.column})
+			}
+		}
+	}
+	a.inInvalid = unit.Invalid
+
+	a.offset += int64(unit.Size)
+	if unit.Rune == a.delimiter && !unit.Invalid {
+		a.line++
+		a.column = 1
+	} else {
+		a.column++
+	}
+}
+
+// Report returns the report for everything seen so far.
+func (a *encodingAccumulator) Report() EncodingReport {
+	report := a.report
+	report.Errors = append([]EncodingError(nil), a.report.Errors...)
+	report.BOM = byteOrderMark(a.head)
+
+	return report
+}
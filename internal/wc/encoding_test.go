@@ -0,0 +1,127 @@
+package wc_test
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"cc/wcx/internal/wc"
+)
+
+func TestEncodingReport(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  wc.EncodingReport
+	}{
+		{name: "empty", input: "", want: wc.EncodingReport{}},
+		{name: "valid", input: "héllo\nwörld\n", want: wc.EncodingReport{}},
+		{name: "utf-8 bom", input: "\xef\xbb\xbfhi\n", want: wc.EncodingReport{BOM: "utf-8"}},
+		{name: "utf-16be bom", input: "\xfe\xff\x00h", want: wc.EncodingReport{
+			BOM: "utf-16be", InvalidSequences: 1, InvalidBytes: 2,
+			Errors: []wc.EncodingError{{Offset: 0, Line: 1, Column: 1}},
+		}},
+		{name: "utf-32le bom", input: "\xff\xfe\x00\x00h\x00\x00\x00", want: wc.EncodingReport{
+			BOM: "utf-32le", InvalidSequences: 1, InvalidBytes: 2,
+			Errors: []wc.EncodingError{{Offset: 0, Line: 1, Column: 1}},
+		}},
+		{name: "invalid runs", input: "ok\nbad \xff\xfe here\nand \xc3\n", want: wc.EncodingReport{
+			InvalidSequences: 2, InvalidBytes: 3,
+			Errors: []wc.EncodingError{{Offset: 7, Line: 2, Column: 5}, {Offset: 19, Line: 3, Column: 5}},
+		}},
+		{name: "first errors only", input: strings.Repeat("\xff.", 7), want: wc.EncodingReport{
+			InvalidSequences: 7, InvalidBytes: 7,
+			Errors: []wc.EncodingError{
+				{Offset: 0, Line: 1, Column: 1},
+				{Offset: 2, Line: 1, Column: 3},
+				{Offset: 4, Line: 1, Column: 5},
+				{Offset: 6, Line: 1, Column: 7},
+				{Offset: 8, Line: 1, Column: 9},
+			},
+		}},
+	}
+
+	selection := wc.CountSelection{Lines: true, Encoding: true}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := assertChunkInvariant(t, test.input, selection).Encoding
+			if got == nil || !reflect.DeepEqual(*got, test.want) {
+				t.Fatalf("got %+v want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEncodingReportCheck(t *testing.T) {
+	tests := []struct {
+		report    wc.EncodingReport
+		wantError string
+	}{
+		{report: wc.EncodingReport{}},
+		{report: wc.EncodingReport{BOM: "utf-8"}},
+		{report: wc.EncodingReport{BOM: "utf-16le", InvalidSequences: 1, Errors: []wc.EncodingError{{Line: 1, Column: 1}}}, wantError: "not UTF-8: utf-16le byte order mark"},
+		{report: wc.EncodingReport{InvalidSequences: 1, Errors: []wc.EncodingError{{Offset: 7, Line: 2, Column: 5}}}, wantError: "invalid UTF-8 at line 2, column 5 (byte 7)"},
+		{report: wc.EncodingReport{InvalidSequences: 3, Errors: []wc.EncodingError{{Offset: 7, Line: 2, Column: 5}}}, wantError: "invalid UTF-8 at line 2, column 5 (byte 7) and 2 more"},
+	}
+
+	for _, test := range tests {
+		err := test.report.Check()
+		if test.wantError == "" && err != nil {
+			t.Fatalf("Check(%+v) failed: %v", test.report, err)
+		}
+		if test.wantError != "" && (err == nil || err.Error() != test.wantError) {
+			t.Fatalf("Check(%+v): got %v want %q", test.report, err, test.wantError)
+		}
+	}
+}
+
+func TestEncodingReportBOMIsInputStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		where   *regexp.Regexp
+		slice   wc.Slice
+		wantBOM string
+	}{
+		{name: "first line filtered out", input: "\xef\xbb\xbfskip\nkeep\n", where: regexp.MustCompile(`keep`), wantBOM: "utf-8"},
+		{name: "tail of a file with a mark", input: "\xef\xbb\xbfa\nb\n", slice: wc.Slice{Unit: wc.SliceLines, Start: 1, Last: true}, wantBOM: "utf-8"},
+		{name: "tail starting with a mark", input: "a\n\xef\xbb\xbfb\n", slice: wc.Slice{Unit: wc.SliceLines, Start: 1, Last: true}},
+		{name: "bytes after the mark", input: "\xfe\xffab", slice: wc.Slice{Unit: wc.SliceBytes, Start: 3}, wantBOM: "utf-16be"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := wc.RunOptions{Selection: wc.CountSelection{Lines: true, Encoding: true, WhereLine: test.where}, Slice: test.slice}
+			result, _ := runFiles(t, map[string]string{"input.txt": test.input}, options)
+			report := result.Rows[0].Counts.Encoding
+			if report == nil || report.BOM != test.wantBOM {
+				t.Fatalf("got %+v, want byte order mark %q", report, test.wantBOM)
+			}
+		})
+	}
+}
+
+func TestRunRequireUTF8(t *testing.T) {
+	files := map[string]string{"bom.txt": "\xef\xbb\xbfa\n", "clean.txt": "a\nb\n", "latin.txt": "caf\xe9\n"}
+	options := wc.RunOptions{Selection: wc.CountSelection{Lines: true, Encoding: true}, TotalMode: wc.TotalAuto, RequireUTF8: true}
+	result, text := runFiles(t, files, options)
+	if result.Failed != 1 || result.HadErrors {
+		t.Fatalf("unexpected result: failed %d, errors %v", result.Failed, result.HadErrors)
+	}
+	if want := (wc.EncodingReport{InvalidSequences: 1, InvalidBytes: 1}); result.Total.Encoding == nil || !reflect.DeepEqual(*result.Total.Encoding, want) {
+		t.Fatalf("total mismatch: got %+v want %+v", result.Total.Encoding, want)
+	}
+
+	want := strings.Join([]string{
+		"bom.txt: utf-8 byte order mark",
+		"1 invalid-utf8=0 bom.txt",
+		"2 invalid-utf8=0 clean.txt",
+		"latin.txt:1:4: invalid UTF-8 at byte 3",
+		"1 invalid-utf8=1 latin.txt (failed: invalid UTF-8 at line 1, column 4 (byte 3))",
+		"4 invalid-utf8=1 total",
+	}, "\n")
+	if text != want {
+		t.Fatalf("text output mismatch:\ngot  %q\nwant %q", text, want)
+	}
+}
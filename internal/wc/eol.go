@@ -0,0 +1,160 @@
+package wc
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EOLStats describes the line endings of an input. Mixed and NoFinalNewline
+// are 0 or 1 for a single input, so in totals they count inputs.
+type EOLStats struct {
+	LF   int `json:"lf"`
+	CRLF int `json:"crlf"`
+	// CR counts carriage returns not followed by a line feed.
+	CR int `json:"cr"`
+	// Mixed is set when more than one kind of line ending is used.
+	Mixed int `json:"mixed"`
+	// NoFinalNewline is set for a non-empty input whose last byte is not a
+	// line ending; GNU wc -l does not count such a last line.
+	NoFinalNewline int `json:"noFinalNewline"`
+}
+
+// fields labels the statistics for text rows.
+func (s EOLStats) fields() []labeledValue {
+	return []labeledValue{
+		{label: "lf", value: s.LF},
+		{label: "crlf", value: s.CRLF},
+		{label: "cr", value: s.CR},
+		{label: "mixed", value: s.Mixed},
+		{label: "no-final-eol", value: s.NoFinalNewline},
+	}
+}
+
+func (s *EOLStats) add(other EOLStats) {
+	s.LF += other.LF
+	s.CRLF += other.CRLF
+	s.CR += other.CR
+	s.Mixed += other.Mixed
+	s.NoFinalNewline += other.NoFinalNewline
+}
+
+// LineEnding is the line ending style an input is required to use.
+type LineEnding string
+
+const (
+	EOLLF   LineEnding = "lf"
+	EOLCRLF LineEnding = "crlf"
+)
+
+func ParseLineEnding(value string) (LineEnding, bool) {
+	style := LineEnding(strings.ToLower(strings.TrimSpace(value)))
+	switch style {
+	case EOLLF, EOLCRLF:
+		return style, true
+	default:
+		return "", false
+	}
+}
+
+// Check reports how s breaks the rule that every line ends with style,
+// including the last one.
+func (s EOLStats) Check(style LineEnding) error {
+	var problems []string
+	if style != EOLLF && s.LF > 0 {
+		problems = append(problems, plural(s.LF, "LF"))
+	}
+	if style != EOLCRLF && s.CRLF > 0 {
+		problems = append(problems, plural(s.CRLF, "CRLF"))
+	}
+	if s.CR > 0 {
+		problems = append(problems, plural(s.CR, "CR"))
+	}
+	if s.NoFinalNewline > 0 {
+		problems = append(problems, "no final newline")
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("not %s: %s", strings.ToUpper(string(style)), strings.Join(problems, ", "))
+}
+
+func plural(n int, ending string) string {
+	return strconv.Itoa(n) + " " + ending
+}
+
+// eolAccumulator counts line endings over raw chunks. A CR at the end of a
+// chunk is held until the next byte shows whether it starts a CRLF.
+type eolAccumulator struct {
+	stats     EOLStats
+	pendingCR bool
+	last      byte
+	empty     bool
+}
+
+func newEOLAccumulator() *eolAccumulator {
+	return &eolAccumulator{empty: true}
+}
+
+func (a *eolAccumulator) AddChunk(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	a.empty = false
+	a.last = p[len(p)-1]
+
+	pos := 0
+	for {
+		k := bytes.IndexAny(p[pos:], "\r\n")
+		if k < 0 {
+			if a.pendingCR && pos < len(p) {
+				a.stats.CR++
+				a.pendingCR = false
+			}
+			return
+		}
+		i := pos + k
+
+		if a.pendingCR {
+			a.pendingCR = false
+			if i == pos && p[i] == '\n' {
+				a.stats.CRLF++
+				pos = i + 1
+				continue
+			}
+			a.stats.CR++
+		}
+		if p[i] == '\n' {
+			a.stats.LF++
+		} else {
+			a.pendingCR = true
+		}
+		pos = i + 1
+	}
+}
+
+// Stats returns the statistics of everything seen so far, treating a held
+// CR as a lone one.
+func (a *eolAccumulator) Stats() EOLStats {
+	stats := a.stats
+	if a.pendingCR {
+		stats.CR++
+	}
+
+	kinds := 0
+	for _, n := range []int{stats.LF, stats.CRLF, stats.CR} {
+		if n > 0 {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		stats.Mixed = 1
+	}
+	if !a.empty && a.last != '\n' && a.last != '\r' {
+		stats.NoFinalNewline = 1
+	}
+
+	return stats
+}
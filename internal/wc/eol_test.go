@@ -0,0 +1,81 @@
+package wc_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"cc/wcx/internal/wc"
+)
+
+func TestEOLStats(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  wc.EOLStats
+	}{
+		{name: "empty", input: "", want: wc.EOLStats{}},
+		{name: "lf", input: "a\nb\n", want: wc.EOLStats{LF: 2}},
+		{name: "crlf", input: "a\r\nb\r\n", want: wc.EOLStats{CRLF: 2}},
+		{name: "lone cr", input: "a\rb\r", want: wc.EOLStats{CR: 2}},
+		{name: "cr then lf later", input: "a\rb\n", want: wc.EOLStats{LF: 1, CR: 1, Mixed: 1}},
+		{name: "cr cr lf", input: "\r\r\n", want: wc.EOLStats{CRLF: 1, CR: 1, Mixed: 1}},
+		{name: "no final newline", input: "a\nb", want: wc.EOLStats{LF: 1, NoFinalNewline: 1}},
+		{name: "no newline at all", input: "abc", want: wc.EOLStats{NoFinalNewline: 1}},
+	}
+
+	selection := wc.CountSelection{Lines: true, EOL: true}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := assertChunkInvariant(t, test.input, selection).EOL
+			if got == nil || !reflect.DeepEqual(*got, test.want) {
+				t.Fatalf("got %+v want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEOLStatsCheck(t *testing.T) {
+	tests := []struct {
+		stats     wc.EOLStats
+		style     wc.LineEnding
+		wantError string
+	}{
+		{stats: wc.EOLStats{LF: 3}, style: wc.EOLLF},
+		{stats: wc.EOLStats{CRLF: 3}, style: wc.EOLCRLF},
+		{stats: wc.EOLStats{LF: 1, CRLF: 2, Mixed: 1}, style: wc.EOLLF, wantError: "not LF: 2 CRLF"},
+		{stats: wc.EOLStats{LF: 1, CR: 1, Mixed: 1, NoFinalNewline: 1}, style: wc.EOLCRLF, wantError: "not CRLF: 1 LF, 1 CR, no final newline"},
+	}
+
+	for _, test := range tests {
+		err := test.stats.Check(test.style)
+		if test.wantError == "" && err != nil {
+			t.Fatalf("Check(%+v, %s) failed: %v", test.stats, test.style, err)
+		}
+		if test.wantError != "" && (err == nil || err.Error() != test.wantError) {
+			t.Fatalf("Check(%+v, %s): got %v want %q", test.stats, test.style, err, test.wantError)
+		}
+	}
+}
+
+func TestRunRequireEOL(t *testing.T) {
+	files := map[string]string{"unix.txt": "a\nb\n", "windows.txt": "a\r\nb\r\n", "cut.txt": "a\nb"}
+	options := wc.RunOptions{Selection: wc.CountSelection{Lines: true, EOL: true}, TotalMode: wc.TotalAuto, RequireEOL: wc.EOLLF}
+	result, text := runFiles(t, files, options)
+	if result.Failed != 2 || result.HadErrors {
+		t.Fatalf("unexpected result: failed %d, errors %v", result.Failed, result.HadErrors)
+	}
+	if want := (wc.EOLStats{LF: 3, CRLF: 2, NoFinalNewline: 1}); result.Total.EOL == nil || *result.Total.EOL != want {
+		t.Fatalf("total mismatch: got %+v want %+v", result.Total.EOL, want)
+	}
+
+	want := strings.Join([]string{
+		"1 lf=1 crlf=0 cr=0 mixed=0 no-final-eol=1 cut.txt (failed: not LF: no final newline)",
+		"2 lf=2 crlf=0 cr=0 mixed=0 no-final-eol=0 unix.txt",
+		"2 lf=0 crlf=2 cr=0 mixed=0 no-final-eol=0 windows.txt (failed: not LF: 2 CRLF)",
+		"5 lf=3 crlf=2 cr=0 mixed=0 no-final-eol=1 total",
+	}, "\n")
+	if text != want {
+		t.Fatalf("text output mismatch:\ngot  %q\nwant %q", text, want)
+	}
+}
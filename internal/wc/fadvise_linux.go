@@ -0,0 +1,71 @@
+//go:build linux && (amd64 || arm64 || loong64 || ppc64 || ppc64le || riscv64)
+
+package wc
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	fadvSequential = 2
+	fadvDontNeed   = 4
+)
+
+// adviseSequential asks the kernel for aggressive read-ahead on file.
+func adviseSequential(file *os.File) {
+	fadvise(file, fadvSequential)
+}
+
+// adviseDontNeed drops file's clean pages from the page cache once counted,
+// so a large tree does not evict data other processes are using. Callers
+// check pageCached first: a file that was already resident stays that way.
+func adviseDontNeed(file *os.File) {
+	fadvise(file, fadvDontNeed)
+}
+
+// pageCached reports whether any page of file is in the page cache. When
+// residency cannot be determined it reports true, which keeps the pages.
+func pageCached(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return true
+	}
+	size := info.Size()
+	if size <= 0 || int64(int(size)) != size {
+		return true
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return true
+	}
+	defer func() { _ = syscall.Munmap(data) }()
+
+	pageSize := int64(os.Getpagesize())
+	vec := make([]byte, (size+pageSize-1)/pageSize)
+	_, _, errno := syscall.Syscall(syscall.SYS_MINCORE, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&vec[0])))
+	if errno != 0 {
+		return true
+	}
+	for _, page := range vec {
+		if page&1 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fadvise is best effort; the hints never change what is counted. It goes
+// through SyscallConn because Fd would put pipes into blocking mode, and
+// cancellation relies on read deadlines working on them.
+func fadvise(file *os.File, advice int) {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return
+	}
+	_ = conn.Control(func(fd uintptr) {
+		_, _, _ = syscall.Syscall6(syscall.SYS_FADVISE64, fd, 0, 0, uintptr(advice), 0, 0)
+	})
+}
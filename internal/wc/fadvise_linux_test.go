@@ -0,0 +1,40 @@
+//go:build linux && (amd64 || arm64 || loong64 || ppc64 || ppc64le || riscv64)
+
+package wc
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountOpenedKeepsCachedPages(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "cached.txt"))
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer file.Close()
+	// DONTNEED skips dirty pages; sync so the cached pages are droppable.
+	if _, err := file.WriteString(strings.Repeat("cached line\n", 4096)); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		t.Fatalf("unable to sync file: %v", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("unable to rewind file: %v", err)
+	}
+	if !pageCached(file) {
+		t.Skip("freshly written file is not resident")
+	}
+
+	if _, err := countOpened(context.Background(), file, DefaultSelection(), IORead); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !pageCached(file) {
+		t.Fatalf("counting evicted pages that were cached beforehand")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !(linux && (amd64 || arm64 || loong64 || ppc64 || ppc64le || riscv64))
+
+package wc
+
+import "os"
+
+func adviseSequential(*os.File) {}
+
+func adviseDontNeed(*os.File) {}
+
+func pageCached(*os.File) bool { return true }
@@ -1,61 +1,200 @@
 package wc
 
 import (
-	"encoding/json"
-	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
+// CountSelection chooses what a run counts. It holds metrics and patterns,
+// so it cannot be compared with ==; use Equal.
 type CountSelection struct {
 	Lines         bool
 	Words         bool
 	Chars         bool
 	Bytes         bool
 	MaxLineLength bool
+	// Extra lists custom metrics, reported after the built-in ones in this
+	// order.
+	Extra []Metric
+	// Hash names a content hash to compute in the same pass, reported in
+	// Counts.Hash; empty computes none.
+	Hash string
+	// EOL adds line ending statistics, reported in Counts.EOL and as five
+	// labeled text fields: LF, CRLF, lone CR, mixed, and no final newline.
+	EOL bool
+	// Findings records the lines flagged by metrics that can point at them,
+	// such as trailingWhitespace, in Counts.Findings.
+	Findings bool
+	// Encoding adds a UTF-8 validity report in Counts.Encoding, printed as an
+	// invalid sequence field and lines locating the first errors.
+	Encoding bool
+	// Breakdown counts characters by script or general category in
+	// Counts.Breakdown, printed as a table under each row.
+	Breakdown Breakdown
+	// WhereLine and WhereNotLine, when set, restrict every count to the
+	// lines that match, and do not match, respectively. Lines are matched
+	// without their delimiter.
+	WhereLine    *regexp.Regexp
+	WhereNotLine *regexp.Regexp
+	// RecordDelimiter, a single ASCII byte, ends lines in place of the
+	// newline for the lines, words, and maxLineLength counts, the match and
+	// whitespace metrics, findings, and line filters. Empty means a newline.
+	RecordDelimiter string
+	// UnicodeLineBreaks ends lines at any Unicode line break for the lines
+	// and maxLineLength counts: LF, VT, FF, CR, NEL (U+0085), LS (U+2028),
+	// and PS (U+2029), with CRLF as one. It has no effect with a
+	// RecordDelimiter.
+	UnicodeLineBreaks bool
 }
 
-func (s CountSelection) Fields() []string {
-	fields := make([]string, 0, 5)
-	if s.Lines {
-		fields = append(fields, "lines")
+// Equal reports whether s and other select the same counts. Metrics are the
+// same when they have the same type and name and, like match metrics, count
+// the same thing; patterns when their source is.
+func (s CountSelection) Equal(other CountSelection) bool {
+	if len(s.Extra) != len(other.Extra) || !samePattern(s.WhereLine, other.WhereLine) || !samePattern(s.WhereNotLine, other.WhereNotLine) {
+		return false
 	}
-	if s.Words {
-		fields = append(fields, "words")
+	for i, metric := range s.Extra {
+		if !sameMetric(metric, other.Extra[i]) {
+			return false
+		}
 	}
-	if s.Chars {
-		fields = append(fields, "chars")
+
+	s.Extra, s.WhereLine, s.WhereNotLine = nil, nil, nil
+	other.Extra, other.WhereLine, other.WhereNotLine = nil, nil, nil
+	return reflect.DeepEqual(s, other)
+}
+
+func samePattern(a, b *regexp.Regexp) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
-	if s.Bytes {
-		fields = append(fields, "bytes")
+	return a.String() == b.String()
+}
+
+func sameMetric(a, b Metric) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || a.Name() != b.Name() {
+		return false
 	}
-	if s.MaxLineLength {
-		fields = append(fields, "maxLineLength")
+	if keyed, ok := a.(keyedMetric); ok {
+		return keyed.cacheKey() == b.(keyedMetric).cacheKey()
 	}
+	return reflect.DeepEqual(a, b)
+}
 
-	return fields
+// delimiter is the byte that ends lines.
+func (s CountSelection) delimiter() byte {
+	if s.RecordDelimiter == "" {
+		return '\n'
+	}
+	return s.RecordDelimiter[0]
 }
 
-func (s CountSelection) Metrics(counts Counts) []int {
-	metrics := make([]int, 0, 5)
-	if s.Lines {
-		metrics = append(metrics, counts.Lines)
+// ParseRecordDelimiter reads a record delimiter: a single ASCII character, or
+// one of the escapes \0, \n, \t, \r, and \xHH.
+func ParseRecordDelimiter(value string) (string, bool) {
+	switch {
+	case len(value) == 1:
+	case value == `\0`:
+		value = "\x00"
+	case strings.HasPrefix(value, `\`):
+		r, multibyte, tail, err := strconv.UnquoteChar(value, 0)
+		if err != nil || multibyte || tail != "" {
+			return "", false
+		}
+		value = string(byte(r))
+	default:
+		return "", false
 	}
-	if s.Words {
-		metrics = append(metrics, counts.Words)
+	if value[0] >= utf8.RuneSelf {
+		return "", false
 	}
-	if s.Chars {
-		metrics = append(metrics, counts.Chars)
+
+	return value, true
+}
+
+// Selected returns the selected metrics in output order.
+func (s CountSelection) Selected() []Metric {
+	builtins := recordMetrics(s.delimiter(), s.UnicodeLineBreaks && s.RecordDelimiter == "")
+	metrics := make([]Metric, 0, len(builtins)+len(s.Extra))
+	for i, enabled := range []bool{s.Lines, s.Words, s.Chars, s.Bytes, s.MaxLineLength} {
+		if enabled {
+			metrics = append(metrics, builtins[i])
+		}
+	}
+
+	for _, m := range s.Extra {
+		if delimited, ok := m.(delimitedMetric); ok && s.RecordDelimiter != "" {
+			m = delimited.withDelimiter(s.delimiter())
+		}
+		metrics = append(metrics, m)
 	}
-	if s.Bytes {
-		metrics = append(metrics, counts.Bytes)
+
+	return metrics
+}
+
+func (s CountSelection) Fields() []string {
+	selected := s.Selected()
+	fields := make([]string, 0, len(selected))
+	for _, m := range selected {
+		fields = append(fields, m.Name())
 	}
-	if s.MaxLineLength {
-		metrics = append(metrics, counts.MaxLineLength)
+
+	return fields
+}
+
+func (s CountSelection) Metrics(counts Counts) []int {
+	selected := s.Selected()
+	metrics := make([]int, 0, len(selected))
+	for _, m := range selected {
+		metrics = append(metrics, metricValue(counts, m))
 	}
 
 	return metrics
 }
 
+func (s CountSelection) bytesOnly() bool {
+	return s.Bytes && !s.Lines && !s.Words && !s.Chars && !s.MaxLineLength && len(s.Extra) == 0 && s.Hash == "" && !s.EOL && !s.Encoding && s.Breakdown == "" &&
+		s.WhereLine == nil && s.WhereNotLine == nil
+}
+
+// columnCount is the number of numeric text columns.
+func (s CountSelection) columnCount() int {
+	return len(s.Selected())
+}
+
+// labeledValue is a count text rows print as LABEL=VALUE after the numeric
+// columns, since unlike those it has no GNU wc position that says what it is.
+type labeledValue struct {
+	label string
+	value int
+}
+
+// labeled returns the labeled values of counts: the line ending statistics,
+// then the invalid UTF-8 sequences.
+func (s CountSelection) labeled(counts Counts) []labeledValue {
+	var values []labeledValue
+	if s.EOL {
+		var stats EOLStats
+		if counts.EOL != nil {
+			stats = *counts.EOL
+		}
+		values = append(values, stats.fields()...)
+	}
+	if s.Encoding {
+		invalid := 0
+		if counts.Encoding != nil {
+			invalid = counts.Encoding.InvalidSequences
+		}
+		values = append(values, labeledValue{label: "invalid-utf8", value: invalid})
+	}
+	return values
+}
+
 func DefaultSelection() CountSelection {
 	return CountSelection{Lines: true, Words: true, Bytes: true}
 }
@@ -76,128 +215,301 @@ func SelectionFromFlags(lines, words, chars, bytes, maxLineLength bool) CountSel
 	return selection
 }
 
-func maxIntWidth(rows [][]int) int {
+// textWidth returns the digits of the widest selected value in rows, at least
+// 1.
+func textWidth(rows []OutputRow, selection CountSelection) int {
 	width := 1
 	for _, row := range rows {
-		for _, value := range row {
-			valueWidth := len(fmt.Sprint(value))
-			if valueWidth > width {
-				width = valueWidth
-			}
-		}
+		width = max(width, countsWidth(row.Counts, selection))
 	}
 	return width
 }
 
-func FormatTextRows(rows []OutputRow, selection CountSelection) string {
-	return FormatTextRowsWithAlignment(rows, selection, true)
+func countsWidth(counts Counts, selection CountSelection) int {
+	width := 1
+	for _, value := range selection.Metrics(counts) {
+		width = max(width, len(strconv.Itoa(value)))
+	}
+	return width
 }
 
-func FormatTextRowsWithAlignment(rows []OutputRow, selection CountSelection, align bool) string {
-	if len(rows) == 0 {
-		return ""
+// numberWidth sizes text columns before counting from the sizes inputSizes
+// found, following GNU wc: enough digits for the combined size of the regular
+// files, and at least 7 when any input is not a regular file and so has no
+// size up front. Inputs that cannot be stat'ed are skipped.
+func numberWidth(sizes []int64) int {
+	minimum := 1
+	regularTotal := int64(0)
+	for _, size := range sizes {
+		switch {
+		case size == sizeNotRegular:
+			minimum = 7
+		case size >= 0:
+			regularTotal += size
+		}
 	}
 
-	metricsPerRow := make([][]int, 0, len(rows))
-	for _, row := range rows {
-		metricsPerRow = append(metricsPerRow, selection.Metrics(row.Counts))
-	}
+	return max(minimum, len(strconv.FormatInt(regularTotal, 10)))
+}
 
-	fieldCount := len(selection.Fields())
-	width := maxIntWidth(metricsPerRow)
+// needsWidth reports whether columns are sized at all: a lone input with a
+// single count is never stat'ed and gets width 1.
+func needsWidth(inputs []InputSource, selection CountSelection) bool {
+	return len(inputs) > 1 || len(inputs) == 1 && selection.columnCount() > 1
+}
 
-	lines := make([]string, 0, len(rows))
-	for i, row := range rows {
-		metrics := metricsPerRow[i]
-		line := ""
+// columnWidth is the width each value is padded to when the whole output is
+// measured after the fact: 1, meaning no padding, for a single column or
+// unaligned output.
+func columnWidth(selection CountSelection, width int, align bool) int {
+	if !align || selection.columnCount() == 1 {
+		return 1
+	}
+	return width
+}
 
-		if fieldCount == 1 || !align {
-			parts := make([]string, 0, len(metrics))
-			for _, metric := range metrics {
-				parts = append(parts, fmt.Sprint(metric))
-			}
-			line = strings.Join(parts, " ")
-		} else {
-			parts := make([]string, 0, fieldCount)
-			for _, metric := range metrics {
-				parts = append(parts, fmt.Sprintf("%*d", width, metric))
-			}
-			line = strings.Join(parts, " ")
+// writeTextRow prints one GNU wc line, padding each value to width, after the
+// lines of its findings when they are selected.
+func writeTextRow(w io.Writer, row OutputRow, selection CountSelection, width int) error {
+	line := make([]byte, 0, 64)
+	if selection.Findings {
+		line = appendFindings(line, row)
+	}
+	if selection.Encoding && row.Counts.Encoding != nil {
+		line = appendEncodingErrors(line, row)
+	}
+	for i, value := range selection.Metrics(row.Counts) {
+		if i > 0 {
+			line = append(line, ' ')
 		}
+		digits := strconv.Itoa(value)
+		for pad := len(digits); pad < width; pad++ {
+			line = append(line, ' ')
+		}
+		line = append(line, digits...)
+	}
+	for _, field := range selection.labeled(row.Counts) {
+		line = append(line, ' ')
+		line = append(line, field.label...)
+		line = append(line, '=')
+		line = strconv.AppendInt(line, int64(field.value), 10)
+	}
+	if selection.Hash != "" && (row.Counts.Hash != "" || row.Name != "") {
+		// The total has no digest; blank its column to keep names aligned.
+		line = append(line, ' ')
+		if row.Counts.Hash != "" {
+			line = append(line, row.Counts.Hash...)
+		} else if h := newHash(selection.Hash); h != nil {
+			line = append(line, strings.Repeat(" ", 2*h.Size())...)
+		}
+	}
+	if row.Name != "" {
+		line = append(line, ' ')
+		line = append(line, row.Name...)
+	}
+	if row.Status.Reason != "" {
+		line = append(line, " ("...)
+		line = append(line, row.Status.String()...)
+		line = append(line, ')')
+	}
+	if row.DuplicateOf != "" {
+		line = append(line, " (duplicate of "...)
+		line = append(line, row.DuplicateOf...)
+		line = append(line, ')')
+	}
+	line = append(line, '\n')
+	if selection.Breakdown != "" && len(row.Counts.Breakdown) > 0 {
+		line = appendBreakdown(line, row.Counts.Breakdown)
+	}
+
+	_, err := w.Write(line)
+	return err
+}
 
-		if row.Name != "" {
-			line += " " + row.Name
+// appendFindings lists the flagged lines of row as "NAME:LINE: METRIC" lines,
+// the form editors and CI annotations pick up.
+func appendFindings(line []byte, row OutputRow) []byte {
+	name := row.Name
+	if name == "" {
+		name = "-"
+	}
+	for _, finding := range row.Counts.Findings {
+		line = append(line, name...)
+		line = append(line, ':')
+		line = strconv.AppendInt(line, int64(finding.Line), 10)
+		line = append(line, ": "...)
+		line = append(line, finding.Metric...)
+		line = append(line, '\n')
+	}
+
+	return line
+}
+
+// appendEncodingErrors notes a byte order mark and locates the first invalid
+// sequences of row as "NAME:LINE:COLUMN: invalid UTF-8 at byte OFFSET".
+func appendEncodingErrors(line []byte, row OutputRow) []byte {
+	name := row.Name
+	if name == "" {
+		name = "-"
+	}
+	report := row.Counts.Encoding
+	if report.BOM != "" {
+		line = append(line, name...)
+		line = append(line, ": "...)
+		line = append(line, report.BOM...)
+		line = append(line, " byte order mark\n"...)
+	}
+	for _, e := range report.Errors {
+		line = append(line, name...)
+		line = append(line, ':')
+		line = strconv.AppendInt(line, int64(e.Line), 10)
+		line = append(line, ':')
+		line = strconv.AppendInt(line, int64(e.Column), 10)
+		line = append(line, ": invalid UTF-8 at byte "...)
+		line = strconv.AppendInt(line, e.Offset, 10)
+		line = append(line, '\n')
+	}
+
+	return line
+}
+
+// appendBreakdown writes one indented "CLASS COUNT" line per class of counts,
+// largest first, with the names and counts aligned.
+func appendBreakdown(line []byte, counts map[string]int) []byte {
+	classes := breakdownClasses(counts)
+	nameWidth, countWidth := 0, 0
+	for _, class := range classes {
+		nameWidth = max(nameWidth, len(class))
+		countWidth = max(countWidth, len(strconv.Itoa(counts[class])))
+	}
+	for _, class := range classes {
+		line = append(line, "  "...)
+		line = append(line, class...)
+		digits := strconv.Itoa(counts[class])
+		for pad := len(class) + len(digits); pad < nameWidth+countWidth; pad++ {
+			line = append(line, ' ')
 		}
+		line = append(line, "  "...)
+		line = append(line, digits...)
+		line = append(line, '\n')
+	}
+
+	return line
+}
 
-		lines = append(lines, line)
+func FormatTextRows(rows []OutputRow, selection CountSelection) string {
+	return FormatTextRowsWithAlignment(rows, selection, true)
+}
+
+func FormatTextRowsWithAlignment(rows []OutputRow, selection CountSelection, align bool) string {
+	var builder strings.Builder
+	_ = WriteTextRows(&builder, rows, selection, align)
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+// WriteTextRows prints rows as newline-terminated GNU wc lines, aligned to the
+// widest value unless align is false.
+func WriteTextRows(w io.Writer, rows []OutputRow, selection CountSelection, align bool) error {
+	width := columnWidth(selection, textWidth(rows, selection), align)
+	for _, row := range rows {
+		if err := writeTextRow(w, row, selection, width); err != nil {
+			return err
+		}
 	}
 
-	return strings.Join(lines, "\n")
+	return nil
 }
 
 type JSONFileResult struct {
-	File   string         `json:"file"`
-	Counts map[string]int `json:"counts,omitempty"`
-	Error  string         `json:"error,omitempty"`
+	File        string          `json:"file"`
+	Counts      map[string]int  `json:"counts,omitempty"`
+	Hash        string          `json:"hash,omitempty"`
+	EOL         *EOLStats       `json:"eol,omitempty"`
+	Findings    []Finding       `json:"findings,omitempty"`
+	Encoding    *EncodingReport `json:"encoding,omitempty"`
+	Breakdown   map[string]int  `json:"breakdown,omitempty"`
+	DuplicateOf string          `json:"duplicateOf,omitempty"`
+	Status      string          `json:"status,omitempty"`
+	Error       string          `json:"error,omitempty"`
 }
 
 type JSONOutput struct {
-	Metrics []string         `json:"metrics"`
-	Files   []JSONFileResult `json:"files,omitempty"`
-	Total   map[string]int   `json:"total,omitempty"`
+	Metrics []string `json:"metrics"`
+	// BreakdownBy names the classes of the breakdown maps, if any.
+	BreakdownBy Breakdown        `json:"breakdownBy,omitempty"`
+	Files       []JSONFileResult `json:"files,omitempty"`
+	Total       map[string]int   `json:"total,omitempty"`
+	// TotalEOL sums the line ending statistics of the files.
+	TotalEOL *EOLStats `json:"totalEol,omitempty"`
+	// TotalEncoding sums the invalid sequences and bytes of the files.
+	TotalEncoding *EncodingReport `json:"totalEncoding,omitempty"`
+	// TotalBreakdown sums the breakdowns of the files.
+	TotalBreakdown map[string]int `json:"totalBreakdown,omitempty"`
+	Partial        bool           `json:"partial,omitempty"`
 }
 
 func BuildSelectedMetricsMap(selection CountSelection, counts Counts) map[string]int {
 	selected := make(map[string]int)
-	if selection.Lines {
-		selected["lines"] = counts.Lines
-	}
-	if selection.Words {
-		selected["words"] = counts.Words
-	}
-	if selection.Chars {
-		selected["chars"] = counts.Chars
-	}
-	if selection.Bytes {
-		selected["bytes"] = counts.Bytes
-	}
-	if selection.MaxLineLength {
-		selected["maxLineLength"] = counts.MaxLineLength
+	for _, m := range selection.Selected() {
+		selected[m.Name()] = metricValue(counts, m)
 	}
 
 	return selected
 }
 
 func FormatJSON(rows []OutputRow, selection CountSelection, total *Counts) (string, error) {
-	files := make([]JSONFileResult, 0, len(rows))
-	for _, row := range rows {
-		file := row.Name
-		if file == "" {
-			file = "stdin"
-		}
+	var builder strings.Builder
+	if err := WriteJSON(&builder, rows, selection, total); err != nil {
+		return "", err
+	}
 
-		entry := JSONFileResult{File: file}
-		if row.Error != nil {
-			entry.Error = row.Error.Error()
-		} else {
-			entry.Counts = BuildSelectedMetricsMap(selection, row.Counts)
-		}
+	return strings.TrimSuffix(builder.String(), "\n"), nil
+}
 
-		files = append(files, entry)
+// WriteJSON prints the same document as FormatJSON one row at a time.
+func WriteJSON(w io.Writer, rows []OutputRow, selection CountSelection, total *Counts) error {
+	formatter := &jsonFormatter{w: w}
+	if err := formatter.Begin(Layout{Selection: selection}); err != nil {
+		return err
 	}
-
-	out := JSONOutput{
-		Metrics: selection.Fields(),
-		Files:   files,
+	for _, row := range rows {
+		if err := formatter.Row(row); err != nil {
+			return err
+		}
 	}
-	if total != nil {
-		out.Total = BuildSelectedMetricsMap(selection, *total)
+
+	return formatter.End(Summary{Total: total})
+}
+
+func jsonFileResult(row OutputRow, selection CountSelection) JSONFileResult {
+	file := row.Name
+	if file == "" {
+		file = "stdin"
 	}
 
-	raw, err := json.MarshalIndent(out, "", "  ")
-	if err != nil {
-		return "", err
+	entry := JSONFileResult{File: file}
+	entry.Status = row.Status.String()
+	if row.Error != nil {
+		entry.Error = row.Error.Error()
+	} else if !row.Status.Skipped {
+		entry.Counts = BuildSelectedMetricsMap(selection, row.Counts)
+		entry.DuplicateOf = row.DuplicateOf
+		if selection.Hash != "" {
+			entry.Hash = row.Counts.Hash
+		}
+		if selection.EOL {
+			entry.EOL = row.Counts.EOL
+		}
+		if selection.Findings {
+			entry.Findings = row.Counts.Findings
+		}
+		if selection.Encoding {
+			entry.Encoding = row.Counts.Encoding
+		}
+		if selection.Breakdown != "" {
+			entry.Breakdown = row.Counts.Breakdown
+		}
 	}
 
-	return string(raw), nil
+	return entry
 }
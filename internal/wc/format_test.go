@@ -1,6 +1,10 @@
 package wc_test
 
 import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
 	"testing"
 
 	"cc/wcx/internal/wc"
@@ -46,3 +50,120 @@ func TestFormatTextRows(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteJSONMatchesMarshalIndent(t *testing.T) {
+	selection := wc.DefaultSelection()
+	total := wc.Counts{Lines: 3, Words: 4, Bytes: 5}
+
+	tests := []struct {
+		name  string
+		rows  []wc.OutputRow
+		total *wc.Counts
+	}{
+		{name: "no rows"},
+		{name: "no rows with total", total: &total},
+		{
+			name: "rows, failures, and total",
+			rows: []wc.OutputRow{
+				{Name: "a.txt", Counts: wc.Counts{Lines: 1, Words: 2, Bytes: 3}},
+				{Name: "gone.txt", Error: errors.New("missing")},
+				{Name: "", Counts: wc.Counts{Lines: 2, Words: 2, Bytes: 2}},
+			},
+			total: &total,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := wc.JSONOutput{Metrics: selection.Fields()}
+			for _, row := range test.rows {
+				entry := wc.JSONFileResult{File: row.Name}
+				if entry.File == "" {
+					entry.File = "stdin"
+				}
+				if row.Error != nil {
+					entry.Error = row.Error.Error()
+				} else {
+					entry.Counts = wc.BuildSelectedMetricsMap(selection, row.Counts)
+				}
+				want.Files = append(want.Files, entry)
+			}
+			if test.total != nil {
+				want.Total = wc.BuildSelectedMetricsMap(selection, *test.total)
+			}
+			raw, err := json.MarshalIndent(want, "", "  ")
+			if err != nil {
+				t.Fatalf("MarshalIndent failed: %v", err)
+			}
+
+			var got strings.Builder
+			if err := wc.WriteJSON(&got, test.rows, selection, test.total); err != nil {
+				t.Fatalf("WriteJSON failed: %v", err)
+			}
+			if got.String() != string(raw)+"\n" {
+				t.Fatalf("streamed JSON mismatch:\ngot:\n%s\nwant:\n%s", got.String(), raw)
+			}
+		})
+	}
+}
+
+func TestRenderToStreamsNewlineTerminatedOutput(t *testing.T) {
+	result := wc.RunResult{
+		Rows: []wc.OutputRow{
+			{Name: "a.txt", Counts: wc.Counts{Lines: 1, Words: 2, Bytes: 3}},
+			{Name: "b.txt", Counts: wc.Counts{Lines: 10, Words: 200, Bytes: 3000}},
+		},
+		Total:     wc.Counts{Lines: 11, Words: 202, Bytes: 3003},
+		ShowTotal: true,
+	}
+	options := wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto}
+
+	var out strings.Builder
+	if err := wc.RenderTo(&out, result, options); err != nil {
+		t.Fatalf("RenderTo failed: %v", err)
+	}
+
+	want := "   1    2    3 a.txt\n  10  200 3000 b.txt\n  11  202 3003 total\n"
+	if out.String() != want {
+		t.Fatalf("output mismatch:\ngot  %q\nwant %q", out.String(), want)
+	}
+
+	rendered, err := wc.Render(result, options)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if rendered != strings.TrimSuffix(want, "\n") {
+		t.Fatalf("Render and RenderTo disagree: %q", rendered)
+	}
+}
+
+func TestCountSelectionEqual(t *testing.T) {
+	errorLines := func() wc.Metric { return wc.NewMatchMetric("errors", regexp.MustCompile(`ERROR`), wc.MatchLines) }
+	base := func() wc.CountSelection {
+		return wc.CountSelection{Lines: true, Extra: []wc.Metric{errorLines()}, WhereLine: regexp.MustCompile(`^x`)}
+	}
+
+	if !base().Equal(base()) {
+		t.Fatalf("selections built the same way differ")
+	}
+
+	tests := map[string]func(*wc.CountSelection){
+		"built-in count": func(s *wc.CountSelection) { s.Words = true },
+		"match pattern": func(s *wc.CountSelection) {
+			s.Extra = []wc.Metric{wc.NewMatchMetric("errors", regexp.MustCompile(`WARN`), wc.MatchLines)}
+		},
+		"match unit": func(s *wc.CountSelection) {
+			s.Extra = []wc.Metric{wc.NewMatchMetric("errors", regexp.MustCompile(`ERROR`), wc.MatchOccurrences)}
+		},
+		"extra metric": func(s *wc.CountSelection) { s.Extra = append(s.Extra, errorLines()) },
+		"line filter":  func(s *wc.CountSelection) { s.WhereLine = regexp.MustCompile(`^y`) },
+		"no filter":    func(s *wc.CountSelection) { s.WhereLine = nil },
+	}
+	for name, change := range tests {
+		other := base()
+		change(&other)
+		if base().Equal(other) || other.Equal(base()) {
+			t.Fatalf("%s: selections compare equal", name)
+		}
+	}
+}
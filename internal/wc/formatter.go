@@ -0,0 +1,218 @@
+package wc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	textFormatName = "text"
+	jsonFormatName = "json"
+)
+
+// Formatter renders the rows of one run. Begin is called once, then Row for
+// every row to print in input order, then End. Rows with an Error or a
+// skipped Status are passed on so formats that report them can include them.
+type Formatter interface {
+	Begin(layout Layout) error
+	Row(row OutputRow) error
+	End(summary Summary) error
+}
+
+// Layout describes what a run will print.
+type Layout struct {
+	Selection CountSelection
+	TotalMode TotalMode
+	// Width is the column width text output pads every value to, for
+	// formats that align columns. 0 means it is not known up front.
+	Width int
+}
+
+// Summary closes a run. Total is nil when no total is printed.
+type Summary struct {
+	Total   *Counts
+	Partial bool
+}
+
+// NewFormatterFunc creates a Formatter writing to w for a single run.
+type NewFormatterFunc func(w io.Writer) Formatter
+
+var formatters = struct {
+	sync.RWMutex
+	byName map[string]NewFormatterFunc
+}{byName: map[string]NewFormatterFunc{
+	textFormatName: func(w io.Writer) Formatter { return &textFormatter{w: w} },
+	jsonFormatName: func(w io.Writer) Formatter { return &jsonFormatter{w: w} },
+}}
+
+// RegisterFormatter makes a format selectable by name through
+// RunOptions.Format and --format.
+func RegisterFormatter(name string, create NewFormatterFunc) error {
+	if name == "" {
+		return fmt.Errorf("format name must not be empty")
+	}
+
+	formatters.Lock()
+	defer formatters.Unlock()
+	if _, exists := formatters.byName[name]; exists {
+		return fmt.Errorf("format %q is already registered", name)
+	}
+	formatters.byName[name] = create
+
+	return nil
+}
+
+// LookupFormatter returns the constructor registered for name.
+func LookupFormatter(name string) (NewFormatterFunc, bool) {
+	formatters.RLock()
+	defer formatters.RUnlock()
+	create, ok := formatters.byName[name]
+	return create, ok
+}
+
+// FormatterNames lists the registered formats sorted by name.
+func FormatterNames() []string {
+	formatters.RLock()
+	defer formatters.RUnlock()
+
+	names := make([]string, 0, len(formatters.byName))
+	for name := range formatters.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// textFormatter prints GNU wc lines, leaving out skipped rows. With a known
+// Layout.Width every row is written as it arrives; otherwise rows are held
+// until End to measure them.
+type textFormatter struct {
+	w      io.Writer
+	layout Layout
+	held   []OutputRow
+}
+
+func (f *textFormatter) Begin(layout Layout) error {
+	f.layout = layout
+	return nil
+}
+
+func (f *textFormatter) Row(row OutputRow) error {
+	if row.Error != nil || row.Status.Skipped {
+		return nil
+	}
+	if f.layout.Width == 0 {
+		f.held = append(f.held, row)
+		return nil
+	}
+
+	return writeTextRow(f.w, row, f.layout.Selection, f.layout.Width)
+}
+
+func (f *textFormatter) End(summary Summary) error {
+	rows := f.held
+	if summary.Total != nil {
+		name := "total"
+		if f.layout.TotalMode == TotalOnly {
+			name = ""
+		}
+		rows = append(rows, OutputRow{Name: name, Counts: *summary.Total})
+	}
+
+	if f.layout.Width == 0 {
+		return WriteTextRows(f.w, rows, f.layout.Selection, f.layout.TotalMode != TotalOnly)
+	}
+	for _, row := range rows {
+		if err := writeTextRow(f.w, row, f.layout.Selection, f.layout.Width); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jsonFormatter streams the JSONOutput document, writing each file entry as it
+// arrives. The bytes match json.MarshalIndent(output, "", "  ").
+type jsonFormatter struct {
+	w      io.Writer
+	layout Layout
+	files  int
+}
+
+func (f *jsonFormatter) Begin(layout Layout) error {
+	f.layout = layout
+	if err := f.writeField("{\n  ", "metrics", layout.Selection.Fields()); err != nil {
+		return err
+	}
+	if layout.Selection.Breakdown != "" {
+		return f.writeField(",\n  ", "breakdownBy", layout.Selection.Breakdown)
+	}
+
+	return nil
+}
+
+func (f *jsonFormatter) Row(row OutputRow) error {
+	prefix := ",\n    "
+	if f.files == 0 {
+		prefix = ",\n  \"files\": [\n    "
+	}
+	f.files++
+
+	raw, err := json.MarshalIndent(jsonFileResult(row, f.layout.Selection), "    ", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(f.w, prefix+string(raw))
+	return err
+}
+
+func (f *jsonFormatter) End(summary Summary) error {
+	if f.files > 0 {
+		if _, err := io.WriteString(f.w, "\n  ]"); err != nil {
+			return err
+		}
+	}
+	if summary.Total != nil {
+		if err := f.writeField(",\n  ", "total", BuildSelectedMetricsMap(f.layout.Selection, *summary.Total)); err != nil {
+			return err
+		}
+		if f.layout.Selection.EOL && summary.Total.EOL != nil {
+			if err := f.writeField(",\n  ", "totalEol", summary.Total.EOL); err != nil {
+				return err
+			}
+		}
+		if f.layout.Selection.Encoding && summary.Total.Encoding != nil {
+			if err := f.writeField(",\n  ", "totalEncoding", summary.Total.Encoding); err != nil {
+				return err
+			}
+		}
+		if f.layout.Selection.Breakdown != "" && summary.Total.Breakdown != nil {
+			if err := f.writeField(",\n  ", "totalBreakdown", summary.Total.Breakdown); err != nil {
+				return err
+			}
+		}
+	}
+	if summary.Partial {
+		if err := f.writeField(",\n  ", "partial", true); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(f.w, "\n}\n")
+	return err
+}
+
+func (f *jsonFormatter) writeField(prefix string, name string, value any) error {
+	raw, err := json.MarshalIndent(value, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(f.w, "%s%q: %s", prefix, name, raw)
+	return err
+}
@@ -0,0 +1,130 @@
+package wc_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"cc/wcx/internal/wc"
+)
+
+// tsvFormatter prints one tab-separated line per row and marks failures.
+type tsvFormatter struct {
+	w         io.Writer
+	selection wc.CountSelection
+}
+
+func (f *tsvFormatter) Begin(layout wc.Layout) error {
+	f.selection = layout.Selection
+	_, err := fmt.Fprintf(f.w, "file\t%s\n", strings.Join(layout.Selection.Fields(), "\t"))
+	return err
+}
+
+func (f *tsvFormatter) Row(row wc.OutputRow) error {
+	if row.Error != nil {
+		_, err := fmt.Fprintf(f.w, "%s\terror\n", row.Name)
+		return err
+	}
+	return f.line(row.Name, row.Counts)
+}
+
+func (f *tsvFormatter) End(summary wc.Summary) error {
+	if summary.Total == nil {
+		return nil
+	}
+	return f.line("total", *summary.Total)
+}
+
+func (f *tsvFormatter) line(name string, counts wc.Counts) error {
+	fields := []string{name}
+	for _, value := range f.selection.Metrics(counts) {
+		fields = append(fields, fmt.Sprint(value))
+	}
+	_, err := fmt.Fprintln(f.w, strings.Join(fields, "\t"))
+	return err
+}
+
+func init() {
+	err := wc.RegisterFormatter("tsv", func(w io.Writer) wc.Formatter { return &tsvFormatter{w: w} })
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRenderWithFormatter(t *testing.T) {
+	result := wc.RunResult{
+		Rows: []wc.OutputRow{
+			{Name: "a.txt", Counts: wc.Counts{Lines: 1, Words: 2, Bytes: 3}},
+			{Name: "gone.txt", Error: errors.New("missing")},
+			{Name: "b.txt", Counts: wc.Counts{Lines: 4, Words: 5, Bytes: 6}},
+		},
+		Total:     wc.Counts{Lines: 5, Words: 7, Bytes: 9},
+		ShowTotal: true,
+		HadErrors: true,
+	}
+
+	tests := []struct {
+		name    string
+		options wc.RunOptions
+		want    string
+	}{
+		{
+			name:    "registered format",
+			options: wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto, Format: "tsv"},
+			want:    "file\tlines\twords\tbytes\na.txt\t1\t2\t3\ngone.txt\terror\nb.txt\t4\t5\t6\ntotal\t5\t7\t9",
+		},
+		{
+			name:    "total only keeps failures",
+			options: wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalOnly, Format: "tsv"},
+			want:    "file\tlines\twords\tbytes\ngone.txt\terror\ntotal\t5\t7\t9",
+		},
+		{
+			name:    "text is the default",
+			options: wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto},
+			want:    "1 2 3 a.txt\n4 5 6 b.txt\n5 7 9 total",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := wc.Render(result, test.options)
+			if err != nil {
+				t.Fatalf("Render failed: %v", err)
+			}
+			if got != test.want {
+				t.Fatalf("output mismatch:\ngot  %q\nwant %q", got, test.want)
+			}
+		})
+	}
+
+	byName, err := wc.Render(result, wc.RunOptions{Selection: wc.DefaultSelection(), Format: "json"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	bySwitch, err := wc.Render(result, wc.RunOptions{Selection: wc.DefaultSelection(), JSON: true})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if byName != bySwitch {
+		t.Fatalf("Format json and JSON differ:\n%s\n%s", byName, bySwitch)
+	}
+
+	if _, err := wc.Render(result, wc.RunOptions{Format: "yaml"}); err == nil {
+		t.Fatalf("expected an error for an unregistered format")
+	}
+}
+
+func TestRegisterFormatter(t *testing.T) {
+	create := func(w io.Writer) wc.Formatter { return &tsvFormatter{w: w} }
+	for _, name := range []string{"", "text", "tsv"} {
+		if err := wc.RegisterFormatter(name, create); err == nil {
+			t.Fatalf("expected RegisterFormatter(%q) to fail", name)
+		}
+	}
+
+	if got := wc.FormatterNames(); strings.Join(got, ",") != "json,text,tsv" {
+		t.Fatalf("formatter names mismatch: got %v", got)
+	}
+}
@@ -0,0 +1,38 @@
+package wc
+
+import (
+	"crypto/sha256"
+	"hash"
+	"sort"
+
+	"cc/wcx/internal/digest"
+)
+
+// hashes are the content hashes CountSelection.Hash can name.
+var hashes = map[string]func() hash.Hash{
+	"sha256":  sha256.New,
+	"xxh64":   func() hash.Hash { return digest.NewXXH64() },
+	"blake2b": digest.NewBLAKE2b512,
+}
+
+// HashNames lists the supported content hashes sorted by name.
+func HashNames() []string {
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// newHash returns a fresh hash for name, or nil when name is empty or not
+// supported.
+func newHash(name string) hash.Hash {
+	create, ok := hashes[name]
+	if !ok {
+		return nil
+	}
+
+	return create()
+}
@@ -0,0 +1,28 @@
+//go:build darwin || freebsd || netbsd
+
+package wc
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// identify returns the cache identity of an open regular file.
+func identify(file *os.File, _ string) (fileIdentity, bool) {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return fileIdentity{}, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileIdentity{}, false
+	}
+
+	return fileIdentity{
+		key:        strconv.FormatUint(uint64(stat.Dev), 10) + ":" + strconv.FormatUint(uint64(stat.Ino), 10),
+		size:       info.Size(),
+		modTime:    info.ModTime().UnixNano(),
+		changeTime: stat.Ctimespec.Nano(),
+	}, true
+}
@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !freebsd && !netbsd
+
+package wc
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// identify returns the cache identity of an open regular file. Without inode
+// numbers or a change time the file is keyed by its absolute path and
+// validated by size and modification time alone.
+func identify(file *os.File, path string) (fileIdentity, bool) {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return fileIdentity{}, false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fileIdentity{}, false
+	}
+
+	return fileIdentity{key: abs, size: info.Size(), modTime: info.ModTime().UnixNano()}, true
+}
@@ -2,15 +2,24 @@ package wc
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 )
 
 type InputSource struct {
 	Path        string
 	DisplayName string
 	FromStdin   bool
+	// FS, when set, is the filesystem Path is opened from instead of the
+	// operating system's. Path is then a slash-separated fs.FS path.
+	FS fs.FS
+	// Scheme names the registered Opener for operands like
+	// "https://host/file", which is then called with Path.
+	Scheme string
 }
 
 func ReadFile(filename string) ([]byte, error) {
@@ -31,11 +40,39 @@ func ReadFromStdin() ([]byte, error) {
 	return stdin, nil
 }
 
+// stdinInput exposes the process stdin as an *os.File, so size shortcuts
+// still apply, while making Close a no-op.
+type stdinInput struct {
+	*os.File
+}
+
+func (stdinInput) Close() error {
+	return nil
+}
+
 // OpenInput returns a stream for counting. For stdin operands this wraps the
 // process stdin handle without taking ownership of it.
 func OpenInput(input InputSource) (io.ReadCloser, error) {
+	return OpenInputContext(context.Background(), input)
+}
+
+// OpenInputContext is OpenInput for inputs whose opener honours cancellation,
+// such as URLs and commands.
+func OpenInputContext(ctx context.Context, input InputSource) (io.ReadCloser, error) {
 	if input.FromStdin {
-		return io.NopCloser(os.Stdin), nil
+		return stdinInput{os.Stdin}, nil
+	}
+
+	if input.FS != nil {
+		return input.FS.Open(input.Path)
+	}
+
+	if input.Scheme != "" {
+		opener, ok := LookupOpener(input.Scheme)
+		if !ok {
+			return nil, fmt.Errorf("no opener registered for %s://", input.Scheme)
+		}
+		return opener(ctx, input.Path)
 	}
 
 	file, err := os.Open(input.Path)
@@ -46,26 +83,131 @@ func OpenInput(input InputSource) (io.ReadCloser, error) {
 	return file, nil
 }
 
+// statInput stats input in the filesystem it is opened from.
+func statInput(input InputSource) (fs.FileInfo, error) {
+	if input.FS != nil {
+		return fs.Stat(input.FS, input.Path)
+	}
+
+	return os.Stat(input.Path)
+}
+
+// inputSizes holds the size of regular files and one of these for the other
+// inputs.
+const (
+	// sizeNotRegular marks inputs with no size up front, such as pipes and
+	// scheme operands.
+	sizeNotRegular = -1
+	// sizeUnknown marks inputs that could not be stat'ed.
+	sizeUnknown = -2
+)
+
+// inputSizes stats every input once, before counting, for both the schedule
+// and the text column width.
+func inputSizes(inputs []InputSource) []int64 {
+	sizes := make([]int64, len(inputs))
+	for i, input := range inputs {
+		if input.Scheme != "" {
+			sizes[i] = sizeNotRegular
+			continue
+		}
+
+		var info fs.FileInfo
+		var err error
+		if input.FromStdin {
+			info, err = os.Stdin.Stat()
+		} else {
+			info, err = statInput(input)
+		}
+		switch {
+		case err != nil:
+			sizes[i] = sizeUnknown
+		case info.Mode().IsRegular():
+			sizes[i] = info.Size()
+		default:
+			sizes[i] = sizeNotRegular
+		}
+	}
+
+	return sizes
+}
+
+// ResolveOptions adjusts how ResolveInputsOptions reads operands.
+type ResolveOptions struct {
+	// Files0From names a file of NUL-separated names to count instead of
+	// the operands.
+	Files0From string
+	// Files0Schemes opens names read from Files0From through their scheme,
+	// as operands are. Without it they are all paths, the way GNU wc reads
+	// them, since such lists are often built from untrusted file names.
+	Files0Schemes bool
+}
+
 // ResolveInputs enforces GNU wc operand rules and normalizes input sources.
 // When files0From is provided, positional operands are not allowed.
 func ResolveInputs(args []string, files0From string) ([]InputSource, error) {
-	if files0From != "" && len(args) > 0 {
+	return ResolveInputsOptions(args, ResolveOptions{Files0From: files0From})
+}
+
+// ResolveInputsOptions is ResolveInputs with options.
+func ResolveInputsOptions(args []string, options ResolveOptions) ([]InputSource, error) {
+	if options.Files0From != "" && len(args) > 0 {
 		return nil, fmt.Errorf("file operands cannot be combined with --files0-from")
 	}
 
-	if files0From != "" {
-		names, err := ReadFiles0From(files0From)
+	if options.Files0From != "" {
+		names, err := ReadFiles0From(options.Files0From)
 		if err != nil {
 			return nil, err
 		}
-		return namesToInputs(names), nil
+		return namesToInputs(names, options.Files0Schemes), nil
 	}
 
 	if len(args) == 0 {
 		return []InputSource{{Path: "-", DisplayName: "", FromStdin: true}}, nil
 	}
 
-	return namesToInputs(args), nil
+	return namesToInputs(args, true), nil
+}
+
+// ResolveInputsFS expands patterns against fsys with fs.Glob. A match that is
+// a directory contributes every file below it, in fs.WalkDir order. A pattern
+// that matches nothing is kept as a literal path, so it is reported as a
+// missing file the way a shell passes an unmatched glob through to wc.
+func ResolveInputsFS(fsys fs.FS, patterns []string) ([]InputSource, error) {
+	var inputs []InputSource
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			matches = []string{pattern}
+		}
+
+		for _, match := range matches {
+			info, err := fs.Stat(fsys, match)
+			if err != nil || !info.IsDir() {
+				inputs = append(inputs, InputSource{Path: match, DisplayName: match, FS: fsys})
+				continue
+			}
+
+			err = fs.WalkDir(fsys, match, func(name string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !entry.IsDir() {
+					inputs = append(inputs, InputSource{Path: name, DisplayName: name, FS: fsys})
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return inputs, nil
 }
 
 // ReadFiles0From parses a NUL-delimited file list used by --files0-from.
@@ -95,7 +237,41 @@ func ReadFiles0From(path string) ([]string, error) {
 	return names, nil
 }
 
-func namesToInputs(names []string) []InputSource {
+// ExcludeInputs drops file inputs whose path or base name matches any of the
+// shell patterns. Stdin operands are never excluded.
+func ExcludeInputs(inputs []InputSource, patterns []string) []InputSource {
+	if len(patterns) == 0 {
+		return inputs
+	}
+
+	kept := make([]InputSource, 0, len(inputs))
+	for _, input := range inputs {
+		if !input.FromStdin && matchesAny(input.Path, patterns) {
+			continue
+		}
+		kept = append(kept, input)
+	}
+
+	return kept
+}
+
+func matchesAny(path string, patterns []string) bool {
+	base := filepath.Base(path)
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, base); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// namesToInputs turns names into inputs, looking up their scheme if schemes
+// is set.
+func namesToInputs(names []string, schemes bool) []InputSource {
 	inputs := make([]InputSource, 0, len(names))
 	for _, name := range names {
 		if name == "-" {
@@ -103,7 +279,11 @@ func namesToInputs(names []string) []InputSource {
 			continue
 		}
 
-		inputs = append(inputs, InputSource{Path: name, DisplayName: name, FromStdin: false})
+		scheme := ""
+		if schemes {
+			scheme, _ = operandScheme(name)
+		}
+		inputs = append(inputs, InputSource{Path: name, DisplayName: name, Scheme: scheme})
 	}
 
 	return inputs
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"testing/fstest"
 
 	"cc/wcx/internal/wc"
 )
@@ -67,6 +69,54 @@ func TestReadInputSources(t *testing.T) {
 	}
 }
 
+func TestResolveInputsFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":          {Data: []byte("a\n")},
+		"b.md":           {Data: []byte("b\n")},
+		"docs/x.txt":     {Data: []byte("x\n")},
+		"docs/sub/y.txt": {Data: []byte("y\n")},
+	}
+
+	tests := []struct {
+		name      string
+		patterns  []string
+		want      []string
+		wantError bool
+	}{
+		{name: "glob", patterns: []string{"*.txt"}, want: []string{"a.txt"}},
+		{name: "directory is walked", patterns: []string{"docs"}, want: []string{"docs/sub/y.txt", "docs/x.txt"}},
+		{name: "patterns keep their order", patterns: []string{"b.md", "a.txt", "a.txt"}, want: []string{"b.md", "a.txt", "a.txt"}},
+		{name: "unmatched pattern is kept", patterns: []string{"missing*"}, want: []string{"missing*"}},
+		{name: "bad pattern", patterns: []string{"["}, wantError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inputs, err := wc.ResolveInputsFS(fsys, test.patterns)
+			if test.wantError {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveInputsFS failed: %v", err)
+			}
+
+			got := make([]string, 0, len(inputs))
+			for _, input := range inputs {
+				if input.FS == nil || input.FromStdin || input.DisplayName != input.Path {
+					t.Fatalf("unexpected input source: %+v", input)
+				}
+				got = append(got, input.Path)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("paths mismatch: got %v want %v", got, test.want)
+			}
+		})
+	}
+}
+
 func TestResolveInputs(t *testing.T) {
 	tmp := t.TempDir()
 	listPath := filepath.Join(tmp, "files0.list")
@@ -137,3 +187,20 @@ func TestResolveInputs(t *testing.T) {
 		})
 	}
 }
+
+func TestExcludeInputs(t *testing.T) {
+	inputs := []wc.InputSource{
+		{Path: "src/main.go", DisplayName: "src/main.go"},
+		{Path: "assets/logo.png", DisplayName: "assets/logo.png"},
+		{Path: "vendor/lib.go", DisplayName: "vendor/lib.go"},
+		{Path: "-", DisplayName: "-", FromStdin: true},
+	}
+
+	kept := wc.ExcludeInputs(inputs, []string{"*.png", "vendor/*", "-"})
+	if len(kept) != 2 {
+		t.Fatalf("kept input count mismatch: got %d want 2", len(kept))
+	}
+	if kept[0].Path != "src/main.go" || !kept[1].FromStdin {
+		t.Fatalf("unexpected kept inputs: %+v", kept)
+	}
+}
@@ -0,0 +1,106 @@
+package wc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// reservedDescriptors are kept free for stdio, the Go runtime, and anything
+// else the process has open while workers count files.
+const reservedDescriptors = 16
+
+const (
+	openRetries      = 8
+	openRetryBackoff = 5 * time.Millisecond
+)
+
+// workerCount resolves the requested job count. jobs <= 0 means one worker per
+// usable CPU, where usable honours a cgroup CPU quota that runtime.NumCPU and
+// GOMAXPROCS do not see. The result never exceeds the number of inputs or the
+// descriptors left under RLIMIT_NOFILE.
+func workerCount(jobs int, inputCount int) int {
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+		if quota, ok := cgroupCPULimit(); ok {
+			jobs = min(jobs, quota)
+		}
+	}
+
+	if limit := openFileLimit(); limit > 0 {
+		jobs = min(jobs, max(1, limit-reservedDescriptors))
+	}
+
+	return max(1, min(jobs, inputCount))
+}
+
+// parseCPUMax interprets a cgroup v2 cpu.max file ("max 100000" or
+// "200000 100000") as a whole number of CPUs, rounding partial CPUs up.
+func parseCPUMax(contents string) (int, bool) {
+	fields := strings.Fields(contents)
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, false
+	}
+
+	return quotaCPUs(fields[0], fields[1])
+}
+
+// quotaCPUs converts a CFS quota and period in microseconds into CPUs.
+func quotaCPUs(quota string, period string) (int, bool) {
+	q, err := strconv.ParseInt(strings.TrimSpace(quota), 10, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseInt(strings.TrimSpace(period), 10, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+
+	return max(1, int(math.Ceil(float64(q)/float64(p)))), true
+}
+
+// scheduleOrder returns input indices largest first, so a huge file near the
+// end of the operand list starts early instead of running alone at the tail.
+// sizes come from inputSizes. Inputs without a size sort last and keep
+// operand order among themselves, as do files of equal size.
+func scheduleOrder(sizes []int64) []int {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return max(sizes[order[a]], sizeNotRegular) > max(sizes[order[b]], sizeNotRegular)
+	})
+
+	return order
+}
+
+// openInputWithRetry retries OpenInput while the process or system is out of
+// file descriptors, which other goroutines release as they finish.
+func openInputWithRetry(ctx context.Context, input InputSource) (reader io.ReadCloser, err error) {
+	backoff := openRetryBackoff
+	for attempt := 0; ; attempt++ {
+		reader, err = OpenInputContext(ctx, input)
+		if err == nil || attempt == openRetries || !isDescriptorExhaustion(err) {
+			return reader, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func isDescriptorExhaustion(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
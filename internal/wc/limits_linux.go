@@ -0,0 +1,25 @@
+package wc
+
+import "os"
+
+// cgroupCPULimit reads the CPU quota of the cgroup the process runs in, trying
+// the unified (v2) hierarchy first and then the v1 cpu controller.
+func cgroupCPULimit() (int, bool) {
+	if raw, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		return parseCPUMax(string(raw))
+	}
+
+	for _, dir := range []string{"/sys/fs/cgroup/cpu", "/sys/fs/cgroup/cpu,cpuacct"} {
+		quota, err := os.ReadFile(dir + "/cpu.cfs_quota_us")
+		if err != nil {
+			continue
+		}
+		period, err := os.ReadFile(dir + "/cpu.cfs_period_us")
+		if err != nil {
+			continue
+		}
+		return quotaCPUs(string(quota), string(period))
+	}
+
+	return 0, false
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package wc
+
+func cgroupCPULimit() (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package wc
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseCPUMax(t *testing.T) {
+	tests := []struct {
+		contents string
+		want     int
+		wantOK   bool
+	}{
+		{contents: "max 100000\n", wantOK: false},
+		{contents: "200000 100000\n", want: 2, wantOK: true},
+		{contents: "150000 100000", want: 2, wantOK: true},
+		{contents: "50000 100000", want: 1, wantOK: true},
+		{contents: "garbage", wantOK: false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseCPUMax(test.contents)
+		if ok != test.wantOK || got != test.want {
+			t.Fatalf("parseCPUMax(%q) = %d, %v; want %d, %v", test.contents, got, ok, test.want, test.wantOK)
+		}
+	}
+
+	if got, ok := quotaCPUs("-1", "100000"); ok {
+		t.Fatalf("unlimited v1 quota should not limit CPUs, got %d", got)
+	}
+}
+
+func TestWorkerCountBounds(t *testing.T) {
+	if got := workerCount(8, 3); got != 3 {
+		t.Fatalf("workers should not exceed inputs: got %d want 3", got)
+	}
+	if got := workerCount(2, 100); got != 2 {
+		t.Fatalf("explicit jobs mismatch: got %d want 2", got)
+	}
+	if got := workerCount(0, 100); got < 1 {
+		t.Fatalf("auto jobs must be positive: got %d", got)
+	}
+}
+
+func TestScheduleOrderLargestFirst(t *testing.T) {
+	tmp := t.TempDir()
+	sizes := map[string]int{"small": 1, "large": 300, "medium": 20, "equal": 20}
+	inputs := []InputSource{}
+	for _, name := range []string{"small", "medium", "missing", "large", "equal"} {
+		path := filepath.Join(tmp, name)
+		if size, ok := sizes[name]; ok {
+			if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o644); err != nil {
+				t.Fatalf("unable to write %s: %v", name, err)
+			}
+		}
+		inputs = append(inputs, InputSource{Path: path, DisplayName: name})
+	}
+
+	got := scheduleOrder(inputSizes(inputs))
+	want := []int{3, 1, 4, 0, 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("schedule mismatch: got %v want %v", got, want)
+	}
+}
+
+// exhaustedFS fails every open as if out of file descriptors.
+type exhaustedFS struct {
+	attempts *int
+}
+
+func (f exhaustedFS) Open(name string) (fs.File, error) {
+	*f.attempts++
+	return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EMFILE}
+}
+
+func TestOpenInputWithRetryStopsOnCancel(t *testing.T) {
+	attempts := 0
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := openInputWithRetry(ctx, InputSource{Path: "x", FS: exhaustedFS{attempts: &attempts}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	// Waiting out every retry takes over a second.
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond || attempts > openRetries {
+		t.Fatalf("retries continued after cancellation: %d attempts in %s", attempts, elapsed)
+	}
+}
@@ -0,0 +1,125 @@
+package wc
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// MatchUnit is what a MatchMetric counts.
+type MatchUnit string
+
+const (
+	// MatchLines counts the lines with at least one match, like grep -c.
+	MatchLines MatchUnit = "lines"
+	// MatchOccurrences counts non-overlapping matches, several per line if
+	// need be.
+	MatchOccurrences MatchUnit = "matches"
+)
+
+// MatchMetric counts a regular expression over the lines of the input. Lines
+// are matched without their newline, or CountSelection.RecordDelimiter, one at
+// a time, so a match never spans lines and ^ and $ anchor at line boundaries.
+// Values are summed in totals.
+type MatchMetric struct {
+	name      string
+	pattern   *regexp.Regexp
+	unit      MatchUnit
+	delimiter byte
+}
+
+// NewMatchMetric returns a metric called name counting pattern in unit.
+func NewMatchMetric(name string, pattern *regexp.Regexp, unit MatchUnit) *MatchMetric {
+	return &MatchMetric{name: name, pattern: pattern, unit: unit, delimiter: '\n'}
+}
+
+func (m *MatchMetric) Name() string { return m.name }
+
+// Pattern returns the regular expression m counts.
+func (m *MatchMetric) Pattern() *regexp.Regexp { return m.pattern }
+
+// Unit returns what m counts.
+func (m *MatchMetric) Unit() MatchUnit { return m.unit }
+
+func (m *MatchMetric) Merge(total int, value int) int { return sumMerge(total, value) }
+
+func (m *MatchMetric) NewAccumulator() Accumulator {
+	return &matchAccumulator{pattern: m.pattern, occurrences: m.unit == MatchOccurrences, delimiter: m.delimiter, line: 1}
+}
+
+func (m *MatchMetric) withDelimiter(delimiter byte) Metric {
+	delimited := *m
+	delimited.delimiter = delimiter
+	return &delimited
+}
+
+// cacheKey adds the pattern to the name, which alone does not say what is
+// counted.
+func (m *MatchMetric) cacheKey() string {
+	return string(m.unit) + ":" + m.pattern.String()
+}
+
+// matchAccumulator works on raw chunks, holding an unterminated line until
+// its delimiter arrives. The lines with a match are its findings.
+type matchAccumulator struct {
+	pattern     *regexp.Regexp
+	occurrences bool
+	delimiter   byte
+	partial     []byte
+	line        int
+	value       int
+	record      bool
+	findings    []int
+}
+
+func (a *matchAccumulator) AddChunk(p []byte) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, a.delimiter)
+		if i < 0 {
+			a.partial = append(a.partial, p...)
+			return
+		}
+
+		line := p[:i]
+		if len(a.partial) > 0 {
+			a.partial = append(a.partial, line...)
+			line = a.partial
+		}
+		if n := a.count(line); n > 0 {
+			a.value += n
+			if a.record {
+				a.findings = append(a.findings, a.line)
+			}
+		}
+		a.partial = a.partial[:0]
+		a.line++
+		p = p[i+1:]
+	}
+}
+
+func (a *matchAccumulator) count(line []byte) int {
+	if a.occurrences {
+		return len(a.pattern.FindAllIndex(line, -1))
+	}
+	if a.pattern.Match(line) {
+		return 1
+	}
+	return 0
+}
+
+// Value counts an unterminated last line too.
+func (a *matchAccumulator) Value() int {
+	if len(a.partial) == 0 {
+		return a.value
+	}
+	return a.value + a.count(a.partial)
+}
+
+func (a *matchAccumulator) RecordFindings() { a.record = true }
+
+func (a *matchAccumulator) Findings() []int {
+	findings := append([]int(nil), a.findings...)
+	if a.record && len(a.partial) > 0 && a.count(a.partial) > 0 {
+		findings = append(findings, a.line)
+	}
+	return findings
+}
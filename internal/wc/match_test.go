@@ -0,0 +1,124 @@
+package wc_test
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"cc/wcx/internal/wc"
+)
+
+func TestMatchMetric(t *testing.T) {
+	errors := regexp.MustCompile(`ERROR|FATAL`)
+	tests := []struct {
+		name         string
+		input        string
+		want         map[string]int
+		wantFindings []wc.Finding
+	}{
+		{name: "empty", input: "", want: map[string]int{"lines": 0, "matches": 0}},
+		{
+			name:  "several per line",
+			input: "INFO ok\nERROR a ERROR b\nFATAL\n",
+			want:  map[string]int{"lines": 2, "matches": 3},
+			wantFindings: []wc.Finding{
+				{Line: 2, Metric: "lines"},
+				{Line: 2, Metric: "matches"},
+				{Line: 3, Metric: "lines"},
+				{Line: 3, Metric: "matches"},
+			},
+		},
+		{
+			name:  "unterminated last line",
+			input: "ok\nFATAL end",
+			want:  map[string]int{"lines": 1, "matches": 1},
+			wantFindings: []wc.Finding{
+				{Line: 2, Metric: "lines"},
+				{Line: 2, Metric: "matches"},
+			},
+		},
+		{
+			name:  "matches do not span lines",
+			input: "ERR\nOR\n",
+			want:  map[string]int{"lines": 0, "matches": 0},
+		},
+	}
+
+	selection := wc.CountSelection{
+		Extra: []wc.Metric{
+			wc.NewMatchMetric("lines", errors, wc.MatchLines),
+			wc.NewMatchMetric("matches", errors, wc.MatchOccurrences),
+		},
+		Findings: true,
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for split := 0; split <= len(test.input); split++ {
+				counter := wc.NewCounter(selection)
+				_, _ = counter.Write([]byte(test.input[:split]))
+				_, _ = counter.Write([]byte(test.input[split:]))
+				_ = counter.Close()
+
+				counts := counter.Counts()
+				if !reflect.DeepEqual(counts.Extra, test.want) {
+					t.Fatalf("split at %d: got %v want %v", split, counts.Extra, test.want)
+				}
+				if !reflect.DeepEqual(counts.Findings, test.wantFindings) {
+					t.Fatalf("split at %d: findings %v want %v", split, counts.Findings, test.wantFindings)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchMetricAnchorsAtLines(t *testing.T) {
+	selection := wc.CountSelection{Extra: []wc.Metric{
+		wc.NewMatchMetric("blank", regexp.MustCompile(`^$`), wc.MatchLines),
+		wc.NewMatchMetric("words", regexp.MustCompile(`\w+`), wc.MatchOccurrences),
+	}}
+	counts, err := wc.CountReader(strings.NewReader("a b\n\nc\n\n"), selection)
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if want := map[string]int{"blank": 2, "words": 3}; !reflect.DeepEqual(counts.Extra, want) {
+		t.Fatalf("got %v want %v", counts.Extra, want)
+	}
+}
+
+func TestRunMatchTotals(t *testing.T) {
+	files := map[string]string{"a.log": "ERROR one\nok\n", "b.log": "FATAL two\nERROR three\n"}
+	selection := wc.CountSelection{Lines: true, Extra: []wc.Metric{wc.NewMatchMetric("errors", regexp.MustCompile(`ERROR|FATAL`), wc.MatchLines)}}
+	options := wc.RunOptions{Selection: selection, TotalMode: wc.TotalAuto, Format: "json"}
+	_, text := runFiles(t, files, options)
+
+	want := `{
+  "metrics": [
+    "lines",
+    "errors"
+  ],
+  "files": [
+    {
+      "file": "a.log",
+      "counts": {
+        "errors": 1,
+        "lines": 2
+      }
+    },
+    {
+      "file": "b.log",
+      "counts": {
+        "errors": 2,
+        "lines": 2
+      }
+    }
+  ],
+  "total": {
+    "errors": 3,
+    "lines": 4
+  }
+}`
+	if text != want {
+		t.Fatalf("JSON mismatch:\ngot:\n%s\nwant:\n%s", text, want)
+	}
+}
@@ -0,0 +1,364 @@
+package wc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// Unit is one decoded rune of input as seen by metric accumulators.
+type Unit struct {
+	Rune rune
+	// Size is the number of input bytes the rune occupied.
+	Size int
+	// Invalid marks a byte that does not start a valid UTF-8 sequence. Rune
+	// is utf8.RuneError and Size is 1.
+	Invalid bool
+}
+
+// Metric is a named count computed in the same pass over the input as every
+// other selected metric. The built-in lines, words, chars, bytes, and
+// maxLineLength counts are implemented as Metrics too.
+type Metric interface {
+	// Name is used as the JSON key and must be unique.
+	Name() string
+	// NewAccumulator returns fresh state for counting one input.
+	NewAccumulator() Accumulator
+	// Merge folds one input's value into the running total, e.g. a sum or a
+	// maximum.
+	Merge(total int, value int) int
+}
+
+// Accumulator holds the per-input state of a Metric. Implementations must
+// also satisfy RuneAccumulator, ChunkAccumulator, or both. Value may be
+// called at any point and must not change the state.
+type Accumulator interface {
+	Value() int
+}
+
+// RuneAccumulator receives every decoded rune in input order.
+type RuneAccumulator interface {
+	Accumulator
+	AddRune(unit Unit)
+}
+
+// ChunkAccumulator receives the raw input in the chunks it arrives in. Metrics
+// that only need bytes should prefer it, since selections made only of chunk
+// metrics skip UTF-8 decoding entirely.
+type ChunkAccumulator interface {
+	Accumulator
+	AddChunk(p []byte)
+}
+
+// FindingAccumulator is implemented by accumulators that can point at the
+// lines behind their value, such as lines with trailing whitespace. The
+// Counter calls RecordFindings before any input when
+// CountSelection.Findings is set.
+type FindingAccumulator interface {
+	Accumulator
+	RecordFindings()
+	// Findings returns the 1-based numbers of the flagged lines so far.
+	Findings() []int
+}
+
+// Finding is one line flagged by a metric.
+type Finding struct {
+	Line   int    `json:"line"`
+	Metric string `json:"metric"`
+}
+
+// builtinMetric stores its value in a dedicated Counts field rather than in
+// Counts.Extra.
+type builtinMetric interface {
+	Metric
+	field(counts *Counts) *int
+}
+
+// delimitedMetric is implemented by the bundled metrics that work on lines,
+// so they can follow CountSelection.RecordDelimiter like the built-in ones.
+type delimitedMetric interface {
+	Metric
+	withDelimiter(delimiter byte) Metric
+}
+
+var registry = struct {
+	sync.RWMutex
+	metrics map[string]Metric
+}{metrics: bundledMetrics()}
+
+// bundledMetrics are the metrics that ship with wcx but, unlike the built-in
+// ones, are only counted when selected by name.
+func bundledMetrics() map[string]Metric {
+	metrics := make(map[string]Metric)
+	for _, m := range WhitespaceMetrics() {
+		metrics[m.Name()] = m
+	}
+	return metrics
+}
+
+// RegisterMetric makes m selectable by name, e.g. through the --metric
+// option. Names must be unique and may not shadow the built-in metrics.
+func RegisterMetric(m Metric) error {
+	name := m.Name()
+	if name == "" {
+		return fmt.Errorf("metric name must not be empty")
+	}
+	for _, builtin := range builtinMetrics() {
+		if builtin.Name() == name {
+			return fmt.Errorf("metric %q is built in", name)
+		}
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, exists := registry.metrics[name]; exists {
+		return fmt.Errorf("metric %q is already registered", name)
+	}
+	registry.metrics[name] = m
+
+	return nil
+}
+
+// LookupMetric returns the registered metric called name.
+func LookupMetric(name string) (Metric, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	m, ok := registry.metrics[name]
+	return m, ok
+}
+
+func builtinMetrics() []Metric {
+	return recordMetrics('\n', false)
+}
+
+// recordMetrics returns the built-in metrics with lines ending at delimiter,
+// or at any Unicode line break when unicodeBreaks is set.
+func recordMetrics(delimiter byte, unicodeBreaks bool) []Metric {
+	return []Metric{
+		linesMetric{delimiter: delimiter, unicodeBreaks: unicodeBreaks},
+		wordsMetric{delimiter: delimiter},
+		charsMetric{},
+		bytesMetric{},
+		maxLineLengthMetric{delimiter: delimiter, unicodeBreaks: unicodeBreaks},
+	}
+}
+
+// metricValue reads m's value from counts.
+func metricValue(counts Counts, m Metric) int {
+	if builtin, ok := m.(builtinMetric); ok {
+		return *builtin.field(&counts)
+	}
+
+	return counts.Extra[m.Name()]
+}
+
+// setMetricValue stores value for m in counts.
+func setMetricValue(counts *Counts, m Metric, value int) {
+	if builtin, ok := m.(builtinMetric); ok {
+		*builtin.field(counts) = value
+		return
+	}
+
+	if counts.Extra == nil {
+		counts.Extra = make(map[string]int)
+	}
+	counts.Extra[m.Name()] = value
+}
+
+// mergeCounts folds row into total for every selected metric.
+func mergeCounts(total *Counts, row Counts, selection CountSelection) {
+	for _, m := range selection.Selected() {
+		setMetricValue(total, m, m.Merge(metricValue(*total, m), metricValue(row, m)))
+	}
+	if selection.EOL && row.EOL != nil {
+		if total.EOL == nil {
+			total.EOL = &EOLStats{}
+		}
+		total.EOL.add(*row.EOL)
+	}
+	if selection.Encoding && row.Encoding != nil {
+		if total.Encoding == nil {
+			total.Encoding = &EncodingReport{}
+		}
+		total.Encoding.add(*row.Encoding)
+	}
+	if selection.Breakdown != "" && row.Breakdown != nil {
+		if total.Breakdown == nil {
+			total.Breakdown = make(map[string]int)
+		}
+		addBreakdown(total.Breakdown, row.Breakdown)
+	}
+}
+
+func sumMerge(total int, value int) int {
+	return total + value
+}
+
+// linesMetric counts delimiter bytes, newlines unless a record delimiter is
+// selected, or Unicode line breaks.
+type linesMetric struct {
+	delimiter     byte
+	unicodeBreaks bool
+}
+
+func (linesMetric) Name() string                   { return "lines" }
+func (linesMetric) Merge(total int, value int) int { return sumMerge(total, value) }
+func (linesMetric) field(counts *Counts) *int      { return &counts.Lines }
+func (m linesMetric) NewAccumulator() Accumulator {
+	if m.unicodeBreaks {
+		return &lineBreakAccumulator{}
+	}
+	return &lineAccumulator{delimiter: []byte{m.delimiter}}
+}
+
+// lineAccumulator works on raw chunks: an ASCII delimiter byte never occurs
+// inside a multi-byte UTF-8 sequence.
+type lineAccumulator struct {
+	delimiter []byte
+	lines     int
+}
+
+func (a *lineAccumulator) AddChunk(p []byte) { a.lines += bytes.Count(p, a.delimiter) }
+
+func (a *lineAccumulator) Value() int { return a.lines }
+
+// lineBreakAccumulator counts Unicode line breaks, taking CRLF as one.
+type lineBreakAccumulator struct {
+	afterCR bool
+	lines   int
+}
+
+func (a *lineBreakAccumulator) AddRune(unit Unit) {
+	if !unit.Invalid && isLineBreak(unit.Rune) && !(unit.Rune == '\n' && a.afterCR) {
+		a.lines++
+	}
+	a.afterCR = unit.Rune == '\r' && !unit.Invalid
+}
+
+func (a *lineBreakAccumulator) Value() int { return a.lines }
+
+// isLineBreak reports whether r ends a line under the Unicode newline
+// guidelines: LF, VT, FF, CR, NEL, LS, or PS.
+func isLineBreak(r rune) bool {
+	switch r {
+	case '\n', '\v', '\f', '\r', '\u0085', '\u2028', '\u2029':
+		return true
+	default:
+		return false
+	}
+}
+
+// wordsMetric also separates words at a record delimiter.
+type wordsMetric struct {
+	delimiter byte
+}
+
+func (wordsMetric) Name() string                   { return "words" }
+func (wordsMetric) Merge(total int, value int) int { return sumMerge(total, value) }
+func (wordsMetric) field(counts *Counts) *int      { return &counts.Words }
+func (m wordsMetric) NewAccumulator() Accumulator {
+	return &wordAccumulator{posixMode: os.Getenv("POSIXLY_CORRECT") != "", delimiter: rune(m.delimiter)}
+}
+
+// wordAccumulator treats invalid bytes as word content.
+type wordAccumulator struct {
+	posixMode bool
+	delimiter rune
+	inWord    bool
+	words     int
+}
+
+func (a *wordAccumulator) AddRune(unit Unit) {
+	isWhitespace := !unit.Invalid && (unit.Rune == a.delimiter || IsWhitespace(unit.Rune, a.posixMode))
+	if isWhitespace {
+		a.inWord = false
+	} else if !a.inWord {
+		a.words++
+		a.inWord = true
+	}
+}
+
+func (a *wordAccumulator) Value() int { return a.words }
+
+type charsMetric struct{}
+
+func (charsMetric) Name() string                   { return "chars" }
+func (charsMetric) Merge(total int, value int) int { return sumMerge(total, value) }
+func (charsMetric) field(counts *Counts) *int      { return &counts.Chars }
+func (charsMetric) NewAccumulator() Accumulator    { return &charAccumulator{} }
+
+// charAccumulator skips invalid bytes.
+type charAccumulator struct {
+	chars int
+}
+
+func (a *charAccumulator) AddRune(unit Unit) {
+	if !unit.Invalid {
+		a.chars++
+	}
+}
+
+func (a *charAccumulator) Value() int { return a.chars }
+
+type bytesMetric struct{}
+
+func (bytesMetric) Name() string                   { return "bytes" }
+func (bytesMetric) Merge(total int, value int) int { return sumMerge(total, value) }
+func (bytesMetric) field(counts *Counts) *int      { return &counts.Bytes }
+func (bytesMetric) NewAccumulator() Accumulator    { return &byteAccumulator{} }
+
+type byteAccumulator struct {
+	bytes int
+}
+
+func (a *byteAccumulator) AddChunk(p []byte) { a.bytes += len(p) }
+
+func (a *byteAccumulator) Value() int { return a.bytes }
+
+// maxLineLengthMetric measures the records ending at delimiter, or the lines
+// ending at any Unicode line break; a newline inside a record has no width.
+type maxLineLengthMetric struct {
+	delimiter     byte
+	unicodeBreaks bool
+}
+
+func (maxLineLengthMetric) Name() string                   { return "maxLineLength" }
+func (maxLineLengthMetric) Merge(total int, value int) int { return max(total, value) }
+func (maxLineLengthMetric) field(counts *Counts) *int      { return &counts.MaxLineLength }
+func (m maxLineLengthMetric) NewAccumulator() Accumulator {
+	return &lineWidthAccumulator{delimiter: rune(m.delimiter), unicodeBreaks: m.unicodeBreaks}
+}
+
+// lineWidthAccumulator measures display width with 8-column tab stops.
+// Invalid bytes contribute zero width.
+type lineWidthAccumulator struct {
+	delimiter     rune
+	unicodeBreaks bool
+	current       int
+	longest       int
+}
+
+func (a *lineWidthAccumulator) AddRune(unit Unit) {
+	switch {
+	case unit.Invalid:
+	case unit.Rune == a.delimiter, a.unicodeBreaks && isLineBreak(unit.Rune):
+		a.longest = max(a.longest, a.current)
+		a.current = 0
+	case unit.Rune == '\t':
+		a.current += 8 - (a.current % 8)
+	default:
+		a.current += runeDisplayWidth(unit.Rune)
+	}
+}
+
+// Value includes the unterminated last line.
+func (a *lineWidthAccumulator) Value() int { return max(a.longest, a.current) }
+
+// decodeUnit decodes the rune at the start of p, which must be a full rune
+// or the final bytes of the input.
+func decodeUnit(p []byte) Unit {
+	r, size := utf8.DecodeRune(p)
+	return Unit{Rune: r, Size: size, Invalid: r == utf8.RuneError && size == 1}
+}
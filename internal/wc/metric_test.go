@@ -0,0 +1,153 @@
+package wc_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"cc/wcx/internal/wc"
+)
+
+// vowelMetric counts ASCII vowels per rune and sums them in totals.
+type vowelMetric struct{}
+
+func (vowelMetric) Name() string                   { return "vowels" }
+func (vowelMetric) NewAccumulator() wc.Accumulator { return &vowelAccumulator{} }
+func (vowelMetric) Merge(total int, value int) int { return total + value }
+
+type vowelAccumulator struct {
+	vowels int
+}
+
+func (a *vowelAccumulator) AddRune(unit wc.Unit) {
+	if strings.ContainsRune("aeiouAEIOU", unit.Rune) {
+		a.vowels++
+	}
+}
+
+func (a *vowelAccumulator) Value() int { return a.vowels }
+
+// largestChunkMetric reports the largest chunk seen, merged with max.
+type largestChunkMetric struct{}
+
+func (largestChunkMetric) Name() string                   { return "largestChunk" }
+func (largestChunkMetric) NewAccumulator() wc.Accumulator { return &largestChunkAccumulator{} }
+func (largestChunkMetric) Merge(total int, value int) int { return max(total, value) }
+
+type largestChunkAccumulator struct {
+	largest int
+}
+
+func (a *largestChunkAccumulator) AddChunk(p []byte) { a.largest = max(a.largest, len(p)) }
+
+func (a *largestChunkAccumulator) Value() int { return a.largest }
+
+// invalidMetric counts invalid UTF-8 bytes.
+type invalidMetric struct{}
+
+func (invalidMetric) Name() string                   { return "invalid" }
+func (invalidMetric) NewAccumulator() wc.Accumulator { return &invalidAccumulator{} }
+func (invalidMetric) Merge(total int, value int) int { return total + value }
+
+type invalidAccumulator struct {
+	invalid int
+}
+
+func (a *invalidAccumulator) AddRune(unit wc.Unit) {
+	if unit.Invalid {
+		a.invalid++
+	}
+}
+
+func (a *invalidAccumulator) Value() int { return a.invalid }
+
+func TestCustomMetricsFlowThroughRun(t *testing.T) {
+	files := map[string]string{"a.txt": "audio\n", "b.txt": "xyz pie\nsky\n"}
+	selection := wc.CountSelection{Lines: true, Extra: []wc.Metric{vowelMetric{}, largestChunkMetric{}}}
+	options := wc.RunOptions{Selection: selection, TotalMode: wc.TotalAuto}
+
+	result, text := runFiles(t, files, options)
+	for _, row := range result.Rows {
+		if row.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", row.Name, row.Error)
+		}
+	}
+
+	wantTotal := wc.Counts{Lines: 3, Extra: map[string]int{"vowels": 6, "largestChunk": 12}}
+	if !reflect.DeepEqual(result.Total, wantTotal) {
+		t.Fatalf("total mismatch: got %+v want %+v", result.Total, wantTotal)
+	}
+
+	wantText := " 1  4  6 a.txt\n 2  2 12 b.txt\n 3  6 12 total"
+	if text != wantText {
+		t.Fatalf("text output mismatch:\ngot  %q\nwant %q", text, wantText)
+	}
+
+	options.JSON = true
+	out, err := wc.Render(result, options)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	for _, want := range []string{`"vowels"`, `"largestChunk": 12`, `"vowels": 6`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("JSON output missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestCounterCloseFlushesIncompleteSequence(t *testing.T) {
+	selection := wc.CountSelection{Bytes: true, Extra: []wc.Metric{invalidMetric{}}}
+	counter := wc.NewCounter(selection)
+	_, _ = counter.Write([]byte("a\xe2\x82"))
+
+	before := counter.Counts()
+	if before.Bytes != 3 || before.Extra["invalid"] != 0 {
+		t.Fatalf("counts before Close: got %+v", before)
+	}
+
+	if err := counter.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	after := counter.Counts()
+	if after.Bytes != 3 || after.Extra["invalid"] != 2 {
+		t.Fatalf("counts after Close: got %+v", after)
+	}
+}
+
+func init() {
+	if err := wc.RegisterMetric(invalidMetric{}); err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterMetric(t *testing.T) {
+	if got, ok := wc.LookupMetric("invalid"); !ok || got.Name() != "invalid" {
+		t.Fatalf("LookupMetric did not find the registered metric")
+	}
+	if _, ok := wc.LookupMetric("lines"); ok {
+		t.Fatalf("LookupMetric must not return built-in metrics")
+	}
+
+	tests := []struct {
+		name   string
+		metric wc.Metric
+	}{
+		{name: "duplicate", metric: invalidMetric{}},
+		{name: "built in", metric: namedMetric("words")},
+		{name: "empty name", metric: namedMetric("")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := wc.RegisterMetric(test.metric); err == nil {
+				t.Fatalf("expected RegisterMetric(%q) to fail", test.metric.Name())
+			}
+		})
+	}
+}
+
+type namedMetric string
+
+func (m namedMetric) Name() string                 { return string(m) }
+func (namedMetric) NewAccumulator() wc.Accumulator { return &invalidAccumulator{} }
+func (namedMetric) Merge(total int, value int) int { return total + value }
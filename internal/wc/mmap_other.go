@@ -0,0 +1,16 @@
+//go:build !unix
+
+package wc
+
+import (
+	"errors"
+	"os"
+)
+
+const mmapSupported = false
+
+func mmapFile(*os.File, int) ([]byte, error) {
+	return nil, errors.New("mmap is not supported on this platform")
+}
+
+func munmapFile([]byte) {}
@@ -0,0 +1,236 @@
+package wc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Opener opens the input named by target, the full operand including its
+// "scheme://" prefix. The returned reader should stop once ctx is done.
+type Opener func(ctx context.Context, target string) (io.ReadCloser, error)
+
+var openers = struct {
+	sync.RWMutex
+	schemes map[string]Opener
+}{schemes: builtinOpeners()}
+
+// builtinOpeners are registered from the start. OpenCommand is not among
+// them: running commands named by operands has to be asked for.
+func builtinOpeners() map[string]Opener {
+	return map[string]Opener{
+		"file":  openFileURL,
+		"http":  openHTTP,
+		"https": openHTTP,
+		"fd":    openDescriptor,
+	}
+}
+
+// RegisterOpener makes operands of the form "scheme://..." open through
+// opener. Schemes are case-insensitive and cannot be registered twice.
+func RegisterOpener(scheme string, opener Opener) error {
+	if !validScheme(scheme) {
+		return fmt.Errorf("invalid scheme %q", scheme)
+	}
+	scheme = strings.ToLower(scheme)
+
+	openers.Lock()
+	defer openers.Unlock()
+	if _, exists := openers.schemes[scheme]; exists {
+		return fmt.Errorf("scheme %q is already registered", scheme)
+	}
+	openers.schemes[scheme] = opener
+
+	return nil
+}
+
+// LookupOpener returns the opener registered for scheme.
+func LookupOpener(scheme string) (Opener, bool) {
+	openers.RLock()
+	defer openers.RUnlock()
+	opener, ok := openers.schemes[strings.ToLower(scheme)]
+	return opener, ok
+}
+
+// operandScheme returns the registered scheme of name, if it has one. Names
+// with an unknown scheme are plain paths, so a file called "a://b" still
+// counts as it does with GNU wc.
+func operandScheme(name string) (string, bool) {
+	scheme, _, found := strings.Cut(name, "://")
+	if !found || !validScheme(scheme) {
+		return "", false
+	}
+	if _, ok := LookupOpener(scheme); !ok {
+		return "", false
+	}
+
+	return strings.ToLower(scheme), true
+}
+
+// validScheme follows the RFC 3986 scheme syntax.
+func validScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+	for i, r := range scheme {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// openFileURL opens file:///path and file://localhost/path.
+func openFileURL(_ context.Context, target string) (io.ReadCloser, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("file URL host must be empty or localhost")
+	}
+
+	return os.Open(filepath.FromSlash(u.Path))
+}
+
+// openHTTP streams the response body of a GET request. Anything but a 2xx
+// status is an error.
+func openHTTP(ctx context.Context, target string) (io.ReadCloser, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		_ = response.Body.Close()
+		return nil, fmt.Errorf("server returned %s", response.Status)
+	}
+
+	return response.Body, nil
+}
+
+// openDescriptor reads the inherited file descriptor fd://N through a
+// duplicate, so closing the input once counted leaves N open: fd://0 does not
+// close standard input, and a repeated operand reads the descriptor again
+// rather than whatever has since reused its number.
+func openDescriptor(_ context.Context, target string) (io.ReadCloser, error) {
+	fd, err := descriptorNumber(target)
+	if err != nil {
+		return nil, err
+	}
+
+	dup, err := dupDescriptor(fd)
+	if err != nil {
+		return nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+	}
+
+	return os.NewFile(dup, target), nil
+}
+
+// descriptorNumber parses the N of fd://N.
+func descriptorNumber(target string) (int, error) {
+	_, number, _ := strings.Cut(target, "://")
+	fd, err := strconv.Atoi(number)
+	if err != nil || fd < 0 {
+		return 0, fmt.Errorf("invalid file descriptor %q", number)
+	}
+
+	return fd, nil
+}
+
+// OpenCommand runs scheme://COMMAND, such as exec://COMMAND, through the
+// platform shell and reads its standard output. The command's standard error
+// is passed through, and a non-zero exit status is reported once its output
+// has been read. It is not registered by default; register it with
+// RegisterOpener("exec", OpenCommand) only when operands are trusted.
+func OpenCommand(ctx context.Context, target string) (io.ReadCloser, error) {
+	_, command, _ := strings.Cut(target, "://")
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	// Killing the shell does not stop children that inherited its stdout, so
+	// cancellation also closes our end of the pipe to unblock a pending read.
+	stop := context.AfterFunc(ctx, func() { _ = stdout.Close() })
+
+	return &commandReader{ctx: ctx, cmd: cmd, stdout: stdout, stop: stop}, nil
+}
+
+type commandReader struct {
+	ctx    context.Context
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stop   func() bool
+	waited bool
+}
+
+func (r *commandReader) Read(p []byte) (int, error) {
+	if r.waited {
+		return 0, io.EOF
+	}
+
+	n, err := r.stdout.Read(p)
+	if err != nil && err != io.EOF && r.ctx.Err() != nil {
+		return n, r.ctx.Err()
+	}
+	if err != io.EOF {
+		return n, err
+	}
+
+	r.waited = true
+	if waitErr := r.cmd.Wait(); waitErr != nil {
+		if ctxErr := r.ctx.Err(); ctxErr != nil {
+			return n, ctxErr
+		}
+		return n, fmt.Errorf("command failed: %w", waitErr)
+	}
+
+	return n, io.EOF
+}
+
+// Close stops a command whose output was not read to the end.
+func (r *commandReader) Close() error {
+	r.stop()
+	if r.waited {
+		return nil
+	}
+
+	r.waited = true
+	_ = r.cmd.Process.Kill()
+	_ = r.cmd.Wait()
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package wc_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"cc/wcx/internal/wc"
+)
+
+func init() {
+	err := wc.RegisterOpener("mem", func(_ context.Context, target string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(strings.TrimPrefix(target, "mem://"))), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	// exec is not built in; the tests opt in the way --allow-exec does.
+	if err := wc.RegisterOpener("exec", wc.OpenCommand); err != nil {
+		panic(err)
+	}
+}
+
+func TestRunHTTPInputs(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok.txt":
+			_, _ = io.WriteString(w, "one two\nthree\n")
+		case "/slow.txt":
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	inputs, err := wc.ResolveInputs([]string{server.URL + "/ok.txt", server.URL + "/missing.txt", server.URL + "/slow.txt"}, "")
+	if err != nil {
+		t.Fatalf("ResolveInputs failed: %v", err)
+	}
+	if inputs[0].Scheme != "http" {
+		t.Fatalf("scheme mismatch: got %q want http", inputs[0].Scheme)
+	}
+
+	result := wc.Run(inputs, wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto, InputTimeout: 200 * time.Millisecond})
+	if row := result.Rows[0]; row.Error != nil || row.Counts.Lines != 2 || row.Counts.Words != 3 || row.Counts.Bytes != 14 {
+		t.Fatalf("unexpected row for ok.txt: %+v", row)
+	}
+	if row := result.Rows[1]; row.Error == nil || !strings.Contains(row.Error.Error(), "404") {
+		t.Fatalf("expected a 404 error, got %+v", row)
+	}
+	if row := result.Rows[2]; row.Error == nil || !strings.Contains(row.Error.Error(), "timed out") {
+		t.Fatalf("expected a timeout error, got %+v", row)
+	}
+	if !result.HadErrors || result.Partial {
+		t.Fatalf("unexpected result flags: %+v", result)
+	}
+}
+
+func TestRunDescriptorInputsLeaveDescriptorOpen(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unable to create pipe: %v", err)
+	}
+	if _, err := writer.WriteString("one two\n"); err != nil {
+		t.Fatalf("unable to write pipe: %v", err)
+	}
+	writer.Close()
+	path := filepath.Join(t.TempDir(), "plain.txt")
+	if err := os.WriteFile(path, []byte("a b c\n"), 0o644); err != nil {
+		t.Fatalf("unable to write input: %v", err)
+	}
+
+	// The repeated descriptor shares its offset, so it is read in order and
+	// finds the data consumed, as "-" named twice does.
+	operand := fmt.Sprintf("fd://%d", reader.Fd())
+	inputs, err := wc.ResolveInputs([]string{operand, path, operand}, "")
+	if err != nil {
+		t.Fatalf("ResolveInputs failed: %v", err)
+	}
+	result := wc.Run(inputs, wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto, Jobs: 4})
+	for i, want := range []int{2, 3, 0} {
+		if row := result.Rows[i]; row.Error != nil || row.Counts.Words != want {
+			t.Fatalf("row %d: got %+v, want %d words", i, row, want)
+		}
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("the inherited descriptor was closed by the run: %v", err)
+	}
+}
+
+func TestRunSchemeInputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.txt")
+	if err := os.WriteFile(path, []byte("a b c\n"), 0o644); err != nil {
+		t.Fatalf("unable to write input: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		operand   string
+		needsSh   bool
+		wantWords int
+		wantError string
+	}{
+		{name: "file URL", operand: "file://" + filepath.ToSlash(path), wantWords: 3},
+		{name: "registered opener", operand: "mem://x y", wantWords: 2},
+		{name: "unregistered scheme is a path", operand: "nope://x", wantError: "no such file"},
+		{name: "bad descriptor", operand: "fd://x", wantError: "invalid file descriptor"},
+		{name: "command output", operand: "exec://echo one two three four", needsSh: true, wantWords: 4},
+		{name: "failing command", operand: "exec://exit 3", needsSh: true, wantError: "exit status 3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.needsSh && runtime.GOOS == "windows" {
+				t.Skip("command operands are run with /bin/sh in this test")
+			}
+
+			inputs, err := wc.ResolveInputs([]string{test.operand}, "")
+			if err != nil {
+				t.Fatalf("ResolveInputs failed: %v", err)
+			}
+
+			row := wc.Run(inputs, wc.RunOptions{Selection: wc.DefaultSelection()}).Rows[0]
+			if test.wantError != "" {
+				if row.Error == nil || !strings.Contains(row.Error.Error(), test.wantError) {
+					t.Fatalf("expected error containing %q, got %+v", test.wantError, row)
+				}
+				return
+			}
+			if row.Error != nil || row.Counts.Words != test.wantWords || row.Name != test.operand {
+				t.Fatalf("unexpected row: %+v", row)
+			}
+		})
+	}
+}
+
+func TestRegisterOpener(t *testing.T) {
+	noop := func(context.Context, string) (io.ReadCloser, error) { return nil, nil }
+	for _, scheme := range []string{"", "1abc", "a b", "HTTP", "mem"} {
+		if err := wc.RegisterOpener(scheme, noop); err == nil {
+			t.Fatalf("expected RegisterOpener(%q) to fail", scheme)
+		}
+	}
+}
+
+func TestResolveInputsFiles0Schemes(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "names")
+	if err := os.WriteFile(list, []byte("exec://touch pwned\x00http://example.com/x\x00plain.txt\x00"), 0o644); err != nil {
+		t.Fatalf("unable to write list: %v", err)
+	}
+
+	for _, schemes := range []bool{false, true} {
+		inputs, err := wc.ResolveInputsOptions(nil, wc.ResolveOptions{Files0From: list, Files0Schemes: schemes})
+		if err != nil {
+			t.Fatalf("ResolveInputsOptions failed: %v", err)
+		}
+		want := []string{"", "", ""}
+		if schemes {
+			want = []string{"exec", "http", ""}
+		}
+		for i, input := range inputs {
+			if input.Scheme != want[i] {
+				t.Fatalf("schemes %v: %s has scheme %q, want %q", schemes, input.Path, input.Scheme, want[i])
+			}
+		}
+	}
+
+	// A file whose name looks like a URL is counted as a file.
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "http:", "host"), 0o755); err != nil {
+		t.Fatalf("unable to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "http:", "host", "f"), []byte("a b\n"), 0o644); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "names"), []byte("http://host/f\x00"), 0o644); err != nil {
+		t.Fatalf("unable to write list: %v", err)
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd failed: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir failed: %v", err)
+	}
+	defer func() { _ = os.Chdir(workDir) }()
+
+	inputs, err := wc.ResolveInputs(nil, "names")
+	if err != nil {
+		t.Fatalf("ResolveInputs failed: %v", err)
+	}
+	if row := wc.Run(inputs, wc.RunOptions{Selection: wc.DefaultSelection()}).Rows[0]; row.Error != nil || row.Counts.Words != 2 {
+		t.Fatalf("unexpected row: %+v", row)
+	}
+}
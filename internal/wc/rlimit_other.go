@@ -0,0 +1,7 @@
+//go:build !unix
+
+package wc
+
+func openFileLimit() int {
+	return 0
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package wc
+
+import "syscall"
+
+// openFileLimit returns the soft RLIMIT_NOFILE, or 0 when it is unknown.
+func openFileLimit() int {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0
+	}
+	current := uint64(limit.Cur)
+	if current > uint64(^uint(0)>>1) {
+		return 0
+	}
+
+	return int(current)
+}
@@ -1,9 +1,14 @@
 package wc
 
 import (
-	"runtime"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 type TotalMode string
@@ -18,13 +23,80 @@ const (
 type RunOptions struct {
 	Selection CountSelection
 	TotalMode TotalMode
-	JSON      bool
+	// Format names a registered Formatter. When empty, JSON selects "json"
+	// and otherwise "text" is used.
+	Format string
+	JSON   bool
+	IO     IOMode
+	// Jobs caps the number of files counted concurrently; 0 picks one worker
+	// per usable CPU.
+	Jobs int
+	// InputTimeout bounds opening and reading each input that goes through a
+	// scheme opener, such as a URL or a command; 0 means no limit.
+	InputTimeout time.Duration
+	// OnRow, when set, receives each row in input order as soon as it and
+	// every row before it are complete, while later inputs are still being
+	// counted. It is called from the goroutine running Run.
+	OnRow func(row OutputRow)
+	// Cache, when set, reuses counts of unchanged files from earlier runs and
+	// records the counts of files it did not have.
+	Cache *Cache
+	// Binary decides what happens to inputs that look binary; empty counts
+	// them like BinaryCount.
+	Binary BinaryPolicy
+	// RequireEOL, when set, fails the rows of inputs with any other line
+	// ending or without a final newline.
+	RequireEOL LineEnding
+	// RequireUTF8 fails the rows of inputs with invalid UTF-8 or a byte
+	// order mark of another encoding.
+	RequireUTF8 bool
+	// Dedupe marks rows whose content was already seen, through a hard link
+	// or identical bytes, as duplicates and leaves them out of the total.
+	// Content is compared by Selection.Hash, or by SHA-256 when it is empty.
+	Dedupe bool
+	// Slice, when not zero, counts only the selected bytes or lines of each
+	// input.
+	Slice Slice
 }
 
 type OutputRow struct {
 	Name   string
 	Counts Counts
 	Error  error
+	// Status qualifies a row that was read without error.
+	Status RowStatus
+	// DuplicateOf names the earlier input with the same content under
+	// RunOptions.Dedupe.
+	DuplicateOf string
+
+	// fileKey identifies the file for hard link detection under Dedupe.
+	fileKey string
+}
+
+// RowStatus marks rows that need more than their counts to be understood.
+// The zero value is an ordinary counted row.
+type RowStatus struct {
+	// Skipped rows were not counted and are left out of the total.
+	Skipped bool
+	// Failed rows were counted but the input failed a check, such as
+	// RunOptions.RequireEOL or RunOptions.RequireUTF8.
+	Failed bool
+	// Reason says why, such as "binary"; on a row that was counted it flags
+	// something worth reporting about the input.
+	Reason string
+}
+
+// String renders the status as "skipped: REASON", "failed: REASON", REASON,
+// or "".
+func (s RowStatus) String() string {
+	switch {
+	case s.Skipped:
+		return "skipped: " + s.Reason
+	case s.Failed:
+		return "failed: " + s.Reason
+	default:
+		return s.Reason
+	}
 }
 
 type RunResult struct {
@@ -32,6 +104,11 @@ type RunResult struct {
 	Total     Counts
 	ShowTotal bool
 	HadErrors bool
+	// Failed counts the rows whose input failed a check.
+	Failed int
+	// Partial is set when the run was cancelled. Rows then holds only the
+	// inputs that finished, and Total covers just those.
+	Partial bool
 }
 
 func ParseTotalMode(value string) (TotalMode, bool) {
@@ -47,17 +124,50 @@ func ParseTotalMode(value string) (TotalMode, bool) {
 // Run processes inputs, preserving input order in the returned rows even when
 // file counting runs in parallel.
 func Run(inputs []InputSource, options RunOptions) RunResult {
+	return RunContext(context.Background(), inputs, options)
+}
+
+// RunContext is Run with cancellation. Once ctx is done, workers stop picking
+// up inputs and abandon the file they are reading; the result is marked
+// Partial and keeps only the rows that completed.
+func RunContext(ctx context.Context, inputs []InputSource, options RunOptions) RunResult {
+	return runContext(ctx, inputs, options, nil)
+}
+
+// runContext is RunContext with the inputSizes of inputs, when already known.
+func runContext(ctx context.Context, inputs []InputSource, options RunOptions, sizes []int64) RunResult {
 	rows := make([]OutputRow, len(inputs))
+	done := make([]bool, len(inputs))
+	emitter := &rowEmitter{ctx: ctx, onRow: options.OnRow, rows: rows, done: done}
+	if options.Dedupe {
+		emitter.seen = make(map[string]string)
+	}
 
-	if canRunInParallel(inputs) {
-		runParallel(inputs, options.Selection, rows)
+	if options.Jobs != 1 && canRunInParallel(inputs) {
+		if sizes == nil {
+			sizes = inputSizes(inputs)
+		}
+		runParallel(ctx, inputs, options, sizes, emitter)
 	} else {
-		runSequential(inputs, options.Selection, rows)
+		runSequential(ctx, inputs, options, emitter)
+	}
+	emitter.flush()
+
+	partial := ctx.Err() != nil
+	if partial {
+		completed := make([]OutputRow, 0, len(rows))
+		for i, row := range rows {
+			if done[i] && !isCancellation(row.Error) {
+				completed = append(completed, row)
+			}
+		}
+		rows = completed
 	}
 
 	total := Counts{}
 	hadErrors := false
 	successCount := 0
+	failed := 0
 
 	for i := range rows {
 		row := rows[i]
@@ -67,12 +177,11 @@ func Run(inputs []InputSource, options RunOptions) RunResult {
 		}
 
 		successCount++
-		total.Lines += row.Counts.Lines
-		total.Words += row.Counts.Words
-		total.Chars += row.Counts.Chars
-		total.Bytes += row.Counts.Bytes
-		if row.Counts.MaxLineLength > total.MaxLineLength {
-			total.MaxLineLength = row.Counts.MaxLineLength
+		if row.Status.Failed {
+			failed++
+		}
+		if row.DuplicateOf == "" && !row.Status.Skipped {
+			mergeCounts(&total, row.Counts, options.Selection)
 		}
 	}
 
@@ -83,35 +192,62 @@ func Run(inputs []InputSource, options RunOptions) RunResult {
 		Total:     total,
 		ShowTotal: showTotal,
 		HadErrors: hadErrors,
+		Failed:    failed,
+		Partial:   partial,
 	}
 }
 
-// canRunInParallel disables parallelism when stdin is present, since repeated
-// reads from a shared stream are order-dependent.
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// canRunInParallel disables parallelism when stdin is present, either as "-"
+// or as fd://0, or when a descriptor is named twice, since repeated reads
+// from a shared stream are order-dependent.
 func canRunInParallel(inputs []InputSource) bool {
 	if len(inputs) < 2 {
 		return false
 	}
 
+	descriptors := make(map[int]bool)
 	for _, input := range inputs {
 		if input.FromStdin {
 			return false
 		}
+		if !strings.EqualFold(input.Scheme, "fd") {
+			continue
+		}
+		fd, err := descriptorNumber(input.Path)
+		if err != nil {
+			continue
+		}
+		if fd == 0 || descriptors[fd] {
+			return false
+		}
+		descriptors[fd] = true
 	}
 
 	return true
 }
 
-func runSequential(inputs []InputSource, selection CountSelection, rows []OutputRow) {
+func runSequential(ctx context.Context, inputs []InputSource, options RunOptions, emitter *rowEmitter) {
 	for i := range inputs {
-		rows[i] = processInput(inputs[i], selection)
+		if ctx.Err() != nil {
+			return
+		}
+		emitter.rows[i] = processInput(ctx, inputs[i], options)
+		emitter.complete(i)
 	}
 }
 
-func runParallel(inputs []InputSource, selection CountSelection, rows []OutputRow) {
-	workerCount := min(runtime.GOMAXPROCS(0), len(inputs))
+// runParallel feeds workers largest file first; rows are written by input
+// index, so the output order is unaffected by the schedule. Completions are
+// collected on the calling goroutine, which passes them to the emitter.
+func runParallel(ctx context.Context, inputs []InputSource, options RunOptions, sizes []int64, emitter *rowEmitter) {
+	workerCount := workerCount(options.Jobs, len(inputs))
 
 	jobs := make(chan int)
+	finished := make(chan int)
 	var waitGroup sync.WaitGroup
 
 	for i := 0; i < workerCount; i++ {
@@ -119,31 +255,334 @@ func runParallel(inputs []InputSource, selection CountSelection, rows []OutputRo
 		go func() {
 			defer waitGroup.Done()
 			for index := range jobs {
-				rows[index] = processInput(inputs[index], selection)
+				emitter.rows[index] = processInput(ctx, inputs[index], options)
+				finished <- index
 			}
 		}()
 	}
 
-	for i := range inputs {
-		jobs <- i
+	go func() {
+	feed:
+		for _, index := range scheduleOrder(sizes) {
+			select {
+			case jobs <- index:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		close(jobs)
+		waitGroup.Wait()
+		close(finished)
+	}()
+
+	for index := range finished {
+		emitter.complete(index)
+	}
+}
+
+// rowEmitter is the reorder buffer behind RunOptions.OnRow: rows that finish
+// early wait until every row before them has been emitted. Duplicates are
+// detected here too, so the first of several copies in input order is the
+// one that counts, however the workers were scheduled.
+type rowEmitter struct {
+	ctx   context.Context
+	onRow func(OutputRow)
+	rows  []OutputRow
+	done  []bool
+	next  int
+	// seen maps the file and content keys of emitted rows to their names;
+	// nil unless deduplicating.
+	seen map[string]string
+}
+
+func (e *rowEmitter) complete(index int) {
+	e.done[index] = true
+	for e.next < len(e.rows) && e.done[e.next] {
+		e.emit(e.next)
+		e.next++
 	}
-	close(jobs)
-	waitGroup.Wait()
 }
 
-func processInput(input InputSource, selection CountSelection) OutputRow {
-	reader, err := OpenInput(input)
+// flush emits the rows that completed after an earlier input was abandoned
+// by cancellation, matching the rows a partial RunResult keeps.
+func (e *rowEmitter) flush() {
+	for ; e.next < len(e.rows); e.next++ {
+		if e.done[e.next] {
+			e.emit(e.next)
+		}
+	}
+}
+
+func (e *rowEmitter) emit(index int) {
+	row := &e.rows[index]
+	if e.ctx.Err() != nil && isCancellation(row.Error) {
+		return
+	}
+	if e.seen != nil && row.Error == nil && !row.Status.Skipped {
+		e.markDuplicate(row)
+	}
+	if e.onRow != nil {
+		e.onRow(*row)
+	}
+}
+
+func (e *rowEmitter) markDuplicate(row *OutputRow) {
+	var keys []string
+	if row.fileKey != "" {
+		keys = append(keys, "file:"+row.fileKey)
+	}
+	if row.Counts.Hash != "" {
+		keys = append(keys, "hash:"+row.Counts.Hash)
+	}
+
+	for _, key := range keys {
+		if first, ok := e.seen[key]; ok {
+			row.DuplicateOf = first
+			return
+		}
+	}
+
+	name := row.Name
+	if name == "" {
+		name = "-"
+	}
+	for _, key := range keys {
+		e.seen[key] = name
+	}
+}
+
+func processInput(ctx context.Context, input InputSource, options RunOptions) OutputRow {
+	if input.Scheme == "" || options.InputTimeout <= 0 {
+		return countInput(ctx, input, options)
+	}
+
+	inputCtx, cancel := context.WithTimeout(ctx, options.InputTimeout)
+	defer cancel()
+
+	row := countInput(inputCtx, input, options)
+	if row.Error != nil && ctx.Err() == nil && errors.Is(inputCtx.Err(), context.DeadlineExceeded) {
+		row.Error = fmt.Errorf("timed out after %s", options.InputTimeout)
+	}
+
+	return row
+}
+
+// dedupeHash compares contents under RunOptions.Dedupe when no hash is
+// selected.
+const dedupeHash = "sha256"
+
+func countInput(ctx context.Context, input InputSource, options RunOptions) OutputRow {
+	selection := options.Selection
+	if options.Dedupe && selection.Hash == "" {
+		selection.Hash = dedupeHash
+	}
+	if options.RequireEOL != "" {
+		selection.EOL = true
+	}
+	if options.RequireUTF8 {
+		selection.Encoding = true
+	}
+
+	reader, err := openInputWithRetry(ctx, input)
 	if err != nil {
 		return OutputRow{Name: input.DisplayName, Error: err}
 	}
 	defer reader.Close()
+	if !input.FromStdin {
+		stop := context.AfterFunc(ctx, func() { interruptRead(reader) })
+		defer stop()
+	}
 
-	counts, err := CountReader(reader, selection)
-	if err != nil {
-		return OutputRow{Name: input.DisplayName, Error: err}
+	var source io.Reader = reader
+	bom := ""
+	if !options.Slice.IsZero() {
+		// A byte order mark is at the start of the input, not of the slice.
+		if selection.Encoding {
+			head, rest, err := sniff(source)
+			if err != nil {
+				return OutputRow{Name: input.DisplayName, Error: err}
+			}
+			source = rest
+			bom = byteOrderMark(head)
+		}
+		if source, err = sliceInput(source, options.Slice, selection.delimiter()); err != nil {
+			return OutputRow{Name: input.DisplayName, Error: err}
+		}
+	}
+
+	sniffing := options.Binary == BinarySkip || options.Binary == BinaryReport
+	if selection.bytesOnly() && !sniffing {
+		if size, ok, err := bytesBySize(source); ok {
+			if err != nil {
+				return OutputRow{Name: input.DisplayName, Error: err}
+			}
+			return OutputRow{Name: input.DisplayName, Counts: Counts{Bytes: int(size)}}
+		}
+	}
+
+	// Only plain files opened from the OS have an identity the cache and hard
+	// link detection can use; standard input, fs.FS inputs, and scheme
+	// operands are always counted and compared by content.
+	row := OutputRow{Name: input.DisplayName}
+	var id fileIdentity
+	identified := false
+	if file, ok := reader.(*os.File); ok && (options.Cache != nil || options.Dedupe) && !input.FromStdin && input.FS == nil && input.Scheme == "" {
+		id, identified = identify(file, input.Path)
+	}
+	if identified && options.Dedupe {
+		row.fileKey = id.key
+	}
+	caching := identified && options.Cache != nil
+	if caching && !options.Slice.IsZero() {
+		id.key += "|slice=" + string(options.Slice.Unit) + options.Slice.String()
+	}
+	if caching {
+		if counts, binary, hit := options.Cache.lookup(id, selection); hit {
+			row.Counts = counts
+			return checkRow(applyBinaryPolicy(row, binary, options.Binary), options)
+		}
+	}
+
+	// Cache entries record the classification whatever the policy, so a
+	// later run with another policy can still use them.
+	binary := false
+	if sniffing || caching {
+		head, rest, err := sniff(source)
+		if err != nil {
+			return OutputRow{Name: input.DisplayName, Error: err}
+		}
+		source = rest
+		binary = looksBinary(head)
+	}
+	if binary && options.Binary == BinarySkip {
+		return applyBinaryPolicy(row, binary, options.Binary)
 	}
 
-	return OutputRow{Name: input.DisplayName, Counts: counts}
+	var counts Counts
+	sized := false
+	if selection.bytesOnly() {
+		var size int64
+		if size, sized, err = bytesBySize(source); err != nil {
+			return OutputRow{Name: input.DisplayName, Error: err}
+		}
+		counts.Bytes = int(size)
+	}
+	if !sized {
+		counts, err = countOpened(ctx, source, selection, options.IO)
+		// A read cut short by interruptRead fails with a deadline error, or
+		// may even look like the end of a short input.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		if err != nil {
+			return OutputRow{Name: input.DisplayName, Error: err}
+		}
+	}
+	if counts.Encoding != nil && !options.Slice.IsZero() {
+		counts.Encoding.BOM = bom
+	}
+	if caching {
+		options.Cache.store(id, selection, counts, binary)
+	}
+
+	row.Counts = counts
+	return checkRow(applyBinaryPolicy(row, binary, options.Binary), options)
+}
+
+// interruptRead unblocks a read in progress on reader, for inputs such as
+// pipes and FIFOs that can otherwise wait forever for a writer. Readers
+// without deadline support are left to finish on their own.
+func interruptRead(reader io.Reader) {
+	if deadliner, ok := reader.(interface{ SetReadDeadline(time.Time) error }); ok {
+		_ = deadliner.SetReadDeadline(time.Now())
+	}
+}
+
+// applyBinaryPolicy sets the status of a row whose input looks binary.
+func applyBinaryPolicy(row OutputRow, binary bool, policy BinaryPolicy) OutputRow {
+	if !binary {
+		return row
+	}
+
+	switch policy {
+	case BinarySkip:
+		row.Counts = Counts{}
+		row.Status = RowStatus{Skipped: true, Reason: binaryReason}
+	case BinaryReport:
+		row.Status = RowStatus{Reason: binaryReason}
+	}
+
+	return row
+}
+
+// checkRow fails a counted row whose input breaks RunOptions.RequireEOL or
+// RunOptions.RequireUTF8, giving every broken rule in the reason. Rows that
+// already carry a status, such as binary ones, are not checked.
+func checkRow(row OutputRow, options RunOptions) OutputRow {
+	if row.Status != (RowStatus{}) {
+		return row
+	}
+
+	var problems []string
+	if options.RequireEOL != "" && row.Counts.EOL != nil {
+		if err := row.Counts.EOL.Check(options.RequireEOL); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if options.RequireUTF8 && row.Counts.Encoding != nil {
+		if err := row.Counts.Encoding.Check(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		row.Status = RowStatus{Failed: true, Reason: strings.Join(problems, "; ")}
+	}
+
+	return row
+}
+
+// bytesBySize counts source without reading it when its size is known: from
+// fstat for a regular file, from the bounds for a slice of one. It reports
+// false for other readers.
+func bytesBySize(source io.Reader) (int64, bool, error) {
+	switch source := source.(type) {
+	case *fileSection:
+		return source.Size(), true, nil
+	case sizedFile:
+		size, err := countBytesBySize(source)
+		return size, true, err
+	default:
+		return 0, false, nil
+	}
+}
+
+func countOpened(ctx context.Context, reader io.Reader, selection CountSelection, mode IOMode) (Counts, error) {
+	if section, ok := reader.(*fileSection); ok {
+		if size, ok := mapSize(mode, section.offset, section.Size()); ok {
+			counts, mapped, err := countMapped(ctx, section.file, section.offset, size, selection)
+			if err != nil || mapped {
+				return counts, err
+			}
+		}
+	}
+	if file, ok := reader.(*os.File); ok {
+		if size, ok := shouldMap(mode, file); ok {
+			counts, mapped, err := countMapped(ctx, file, 0, size, selection)
+			if err != nil {
+				return Counts{}, err
+			}
+			if mapped {
+				return counts, nil
+			}
+		}
+
+		adviseSequential(file)
+		if !pageCached(file) {
+			defer adviseDontNeed(file)
+		}
+	}
+
+	return CountReaderContext(ctx, reader, selection)
 }
 
 func shouldShowTotal(mode TotalMode, inputCount int, successCount int) bool {
@@ -161,42 +600,126 @@ func shouldShowTotal(mode TotalMode, inputCount int, successCount int) bool {
 	}
 }
 
-// Render applies --total and --json output policy to already computed rows.
-func Render(result RunResult, options RunOptions) (string, error) {
-	rows := make([]OutputRow, 0, len(result.Rows)+1)
-	for _, row := range result.Rows {
-		if row.Error != nil {
-			continue
+// formatName resolves Format and the older JSON switch to a formatter name.
+func (o RunOptions) formatName() string {
+	switch {
+	case o.Format != "":
+		return o.Format
+	case o.JSON:
+		return jsonFormatName
+	default:
+		return textFormatName
+	}
+}
+
+// RunTo runs inputs like RunContext and writes each row to w with the
+// selected formatter as soon as it and every row before it are counted. Text
+// columns are sized up front from the inputs' stat sizes the way GNU wc does,
+// so values from non-regular inputs can end up wider than their column.
+func RunTo(ctx context.Context, w io.Writer, inputs []InputSource, options RunOptions) (RunResult, error) {
+	create, ok := LookupFormatter(options.formatName())
+	if !ok {
+		return RunResult{}, fmt.Errorf("unknown output format %q", options.formatName())
+	}
+	if options.Selection.Hash != "" && newHash(options.Selection.Hash) == nil {
+		return RunResult{}, fmt.Errorf("unknown hash %q", options.Selection.Hash)
+	}
+
+	width := 1
+	var sizes []int64
+	if options.TotalMode != TotalOnly && needsWidth(inputs, options.Selection) {
+		sizes = inputSizes(inputs)
+		width = numberWidth(sizes)
+	}
+
+	formatter := create(w)
+	if err := formatter.Begin(Layout{Selection: options.Selection, TotalMode: options.TotalMode, Width: width}); err != nil {
+		return RunResult{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var writeErr error
+	onRow := options.OnRow
+	options.OnRow = func(row OutputRow) {
+		if onRow != nil {
+			onRow(row)
 		}
-		if options.TotalMode == TotalOnly {
-			continue
+		if writeErr != nil || (options.TotalMode == TotalOnly && row.Error == nil) {
+			return
+		}
+		if writeErr = formatter.Row(row); writeErr != nil {
+			cancel()
 		}
-		rows = append(rows, row)
 	}
 
-	var totalForOutput *Counts
+	result := runContext(ctx, inputs, options, sizes)
+	if writeErr != nil {
+		return result, writeErr
+	}
+
+	summary := Summary{Partial: result.Partial}
 	if result.ShowTotal {
-		totalForOutput = &result.Total
-		totalRowName := "total"
-		if options.TotalMode == TotalOnly {
-			totalRowName = ""
-		}
-		if !options.JSON {
-			rows = append(rows, OutputRow{Name: totalRowName, Counts: result.Total})
+		total := result.Total
+		summary.Total = &total
+	}
+
+	return result, formatter.End(summary)
+}
+
+// Render is RenderTo into a string, without the trailing newline.
+func Render(result RunResult, options RunOptions) (string, error) {
+	var builder strings.Builder
+	if err := RenderTo(&builder, result, options); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(builder.String(), "\n"), nil
+}
+
+// RenderTo applies the --total policy to already computed rows and streams
+// them to w with the selected formatter. Text columns are measured before the
+// first row is written, so no output is buffered.
+func RenderTo(w io.Writer, result RunResult, options RunOptions) error {
+	create, ok := LookupFormatter(options.formatName())
+	if !ok {
+		return fmt.Errorf("unknown output format %q", options.formatName())
+	}
+
+	printed := func(row OutputRow) bool {
+		return options.TotalMode != TotalOnly || row.Error != nil
+	}
+
+	width := 1
+	for _, row := range result.Rows {
+		if row.Error == nil && printed(row) {
+			width = max(width, countsWidth(row.Counts, options.Selection))
 		}
 	}
 
-	if options.JSON {
-		jsonRows := make([]OutputRow, 0, len(result.Rows))
-		for _, row := range result.Rows {
-			if options.TotalMode == TotalOnly && row.Error == nil {
-				continue
-			}
-			jsonRows = append(jsonRows, row)
+	summary := Summary{Partial: result.Partial}
+	if result.ShowTotal {
+		total := result.Total
+		summary.Total = &total
+		width = max(width, countsWidth(total, options.Selection))
+	}
+	width = columnWidth(options.Selection, width, options.TotalMode != TotalOnly)
+
+	formatter := create(w)
+	layout := Layout{Selection: options.Selection, TotalMode: options.TotalMode, Width: width}
+	if err := formatter.Begin(layout); err != nil {
+		return err
+	}
+
+	for _, row := range result.Rows {
+		if !printed(row) {
+			continue
+		}
+		if err := formatter.Row(row); err != nil {
+			return err
 		}
-		return FormatJSON(jsonRows, options.Selection, totalForOutput)
 	}
 
-	align := options.TotalMode != TotalOnly
-	return FormatTextRowsWithAlignment(rows, options.Selection, align), nil
+	return formatter.End(summary)
 }
@@ -1,7 +1,20 @@
 package wc_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"cc/wcx/internal/wc"
 )
@@ -50,3 +63,493 @@ func TestRenderWithTotalOnly(t *testing.T) {
 		t.Fatalf("render output mismatch: got %q want %q", out, "50 520 6300")
 	}
 }
+
+func TestRunByteCountsUseFileSize(t *testing.T) {
+	tmp := t.TempDir()
+	pageAligned := filepath.Join(tmp, "aligned.bin")
+	if err := os.WriteFile(pageAligned, bytes.Repeat([]byte{'x'}, 2*os.Getpagesize()), 0o644); err != nil {
+		t.Fatalf("unable to write fixture: %v", err)
+	}
+
+	inputs := []wc.InputSource{
+		{Path: testFileName, DisplayName: testFileName},
+		{Path: pageAligned, DisplayName: pageAligned},
+	}
+	want := []int{3735, 2 * os.Getpagesize()}
+
+	if procData, err := os.ReadFile("/proc/self/cmdline"); err == nil {
+		inputs = append(inputs, wc.InputSource{Path: "/proc/self/cmdline", DisplayName: "/proc/self/cmdline"})
+		want = append(want, len(procData))
+	}
+
+	selection := wc.SelectionFromFlags(false, false, false, true, false)
+	result := wc.Run(inputs, wc.RunOptions{Selection: selection, TotalMode: wc.TotalNever})
+	for i, row := range result.Rows {
+		if row.Error != nil {
+			t.Fatalf("%s: unexpected error: %v", row.Name, row.Error)
+		}
+		if row.Counts.Bytes != want[i] {
+			t.Fatalf("%s: byte count mismatch: got %d want %d", row.Name, row.Counts.Bytes, want[i])
+		}
+	}
+}
+
+func TestRunByteCountsHonourStdinOffset(t *testing.T) {
+	file, err := os.Open(testFileName)
+	if err != nil {
+		t.Fatalf("unable to open fixture: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(735, io.SeekStart); err != nil {
+		t.Fatalf("unable to seek fixture: %v", err)
+	}
+
+	defer func(original *os.File) { os.Stdin = original }(os.Stdin)
+	os.Stdin = file
+
+	inputs := []wc.InputSource{{Path: "-", DisplayName: "-", FromStdin: true}, {Path: "-", DisplayName: "-", FromStdin: true}}
+	selection := wc.SelectionFromFlags(false, false, false, true, false)
+	result := wc.Run(inputs, wc.RunOptions{Selection: selection, TotalMode: wc.TotalAuto})
+
+	if got := result.Rows[0].Counts.Bytes; got != 3000 {
+		t.Fatalf("first stdin byte count mismatch: got %d want 3000", got)
+	}
+	if got := result.Rows[1].Counts.Bytes; got != 0 {
+		t.Fatalf("second stdin byte count mismatch: got %d want 0", got)
+	}
+}
+
+func TestRunIOModesAgree(t *testing.T) {
+	inputs := []wc.InputSource{{Path: testFileName, DisplayName: testFileName}}
+	selection := wc.CountSelection{Lines: true, Words: true, Chars: true, Bytes: true, MaxLineLength: true, Hash: "sha256"}
+	want := wc.Counts{Lines: 9, Words: 551, Chars: 3735, Bytes: 3735, MaxLineLength: 975}
+	data, err := os.ReadFile(testFileName)
+	if err != nil {
+		t.Fatalf("unable to read %s: %v", testFileName, err)
+	}
+	want.Hash = fmt.Sprintf("%x", sha256.Sum256(data))
+
+	for _, mode := range []wc.IOMode{wc.IORead, wc.IOMmap, wc.IOAuto} {
+		t.Run(string(mode), func(t *testing.T) {
+			result := wc.Run(inputs, wc.RunOptions{Selection: selection, TotalMode: wc.TotalNever, IO: mode})
+			row := result.Rows[0]
+			if row.Error != nil {
+				t.Fatalf("unexpected error: %v", row.Error)
+			}
+			if !reflect.DeepEqual(row.Counts, want) {
+				t.Fatalf("counts mismatch: got %+v want %+v", row.Counts, want)
+			}
+		})
+	}
+}
+
+func TestRunKeepsOperandOrderWithJobs(t *testing.T) {
+	fsys := fstest.MapFS{}
+	var inputs []wc.InputSource
+	for i, size := range []int{10, 5000, 1, 300} {
+		path := fmt.Sprintf("file%d.txt", i)
+		fsys[path] = &fstest.MapFile{Data: bytes.Repeat([]byte("a\n"), size)}
+		inputs = append(inputs, wc.InputSource{Path: path, DisplayName: path, FS: fsys})
+	}
+
+	for _, jobs := range []int{0, 1, 2} {
+		result := wc.Run(inputs, wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto, Jobs: jobs})
+		for i, want := range []int{10, 5000, 1, 300} {
+			row := result.Rows[i]
+			if row.Name != inputs[i].DisplayName || row.Counts.Lines != want {
+				t.Fatalf("jobs=%d row %d mismatch: got %s with %d lines", jobs, i, row.Name, row.Counts.Lines)
+			}
+		}
+	}
+}
+
+func TestRunFSInputs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"one.txt":     {Data: []byte("hello world\n")},
+		"dir/two.txt": {Data: []byte("a\nb\n")},
+	}
+	inputs, err := wc.ResolveInputsFS(fsys, []string{"one.txt", "dir", "gone.txt"})
+	if err != nil {
+		t.Fatalf("ResolveInputsFS failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		selection wc.CountSelection
+		want      string
+	}{
+		{name: "default counts", selection: wc.DefaultSelection(), want: " 1  2 12 one.txt\n 2  2  4 dir/two.txt\n 3  4 16 total"},
+		{name: "bytes from stat", selection: wc.CountSelection{Bytes: true}, want: "12 one.txt\n4 dir/two.txt\n16 total"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := wc.RunOptions{Selection: test.selection, TotalMode: wc.TotalAuto}
+			result := wc.Run(inputs, options)
+			if !result.HadErrors || !errors.Is(result.Rows[2].Error, fs.ErrNotExist) {
+				t.Fatalf("expected a not-exist error for the missing file, got %+v", result.Rows[2])
+			}
+
+			out, err := wc.Render(result, options)
+			if err != nil {
+				t.Fatalf("Render failed: %v", err)
+			}
+			if out != test.want {
+				t.Fatalf("output mismatch:\ngot  %q\nwant %q", out, test.want)
+			}
+		})
+	}
+}
+
+// runFiles runs the in-memory files with options, in name order, and renders
+// the result.
+func runFiles(t *testing.T, files map[string]string, options wc.RunOptions) (wc.RunResult, string) {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	inputs, err := wc.ResolveInputsFS(fsys, []string{"*"})
+	if err != nil {
+		t.Fatalf("ResolveInputsFS failed: %v", err)
+	}
+
+	result := wc.Run(inputs, options)
+	text, err := wc.Render(result, options)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	return result, text
+}
+
+func TestRunContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	inputs := []wc.InputSource{
+		{Path: testFileName, DisplayName: testFileName},
+		{Path: testFileName, DisplayName: testFileName},
+	}
+	result := wc.RunContext(ctx, inputs, wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto})
+	if !result.Partial {
+		t.Fatalf("expected partial result")
+	}
+	if len(result.Rows) != 0 || result.ShowTotal || result.HadErrors {
+		t.Fatalf("unexpected result for cancelled run: %+v", result)
+	}
+
+	out, err := wc.Render(result, wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto, JSON: true})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.Contains(out, `"partial": true`) {
+		t.Fatalf("JSON output is not marked partial: %s", out)
+	}
+}
+
+// blockedPipeWriters keeps the write ends of blocked-pipe:// inputs open, so
+// reads from them wait until the run is cancelled.
+var blockedPipeWriters []*os.File
+
+func init() {
+	err := wc.RegisterOpener("blocked-pipe", func(context.Context, string) (io.ReadCloser, error) {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.WriteString("partial line"); err != nil {
+			return nil, err
+		}
+		blockedPipeWriters = append(blockedPipeWriters, writer)
+		return reader, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRunContextInterruptsBlockedRead(t *testing.T) {
+	defer func() {
+		for _, writer := range blockedPipeWriters {
+			writer.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	fsys := fstest.MapFS{"first.txt": {Data: []byte("one two\n")}}
+	inputs := []wc.InputSource{
+		{Path: "first.txt", DisplayName: "first.txt", FS: fsys},
+		{Path: "blocked-pipe://x", DisplayName: "pipe", Scheme: "blocked-pipe"},
+	}
+
+	start := time.Now()
+	result := wc.RunContext(ctx, inputs, wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto, Jobs: 1})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("run waited %s for the blocked read", elapsed)
+	}
+	if !result.Partial || len(result.Rows) != 1 || result.Rows[0].Name != "first.txt" {
+		t.Fatalf("expected only the completed row in a partial result: %+v", result)
+	}
+	if want := (wc.Counts{Lines: 1, Words: 2, Bytes: 8}); !reflect.DeepEqual(result.Total, want) {
+		t.Fatalf("total includes the interrupted input: got %+v want %+v", result.Total, want)
+	}
+}
+
+// signalWriter closes written on its first write.
+type signalWriter struct {
+	strings.Builder
+	written chan struct{}
+}
+
+func (w *signalWriter) Write(p []byte) (int, error) {
+	if w.Len() == 0 {
+		close(w.written)
+	}
+	return w.Builder.Write(p)
+}
+
+// firstRowWritten gates the after-first-row:// opener.
+var firstRowWritten chan struct{}
+
+func init() {
+	err := wc.RegisterOpener("after-first-row", func(context.Context, string) (io.ReadCloser, error) {
+		select {
+		case <-firstRowWritten:
+			return io.NopCloser(strings.NewReader("late\n")), nil
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("first row was not written while the run was going")
+		}
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRunToStreamsRowsBeforeTheRunEnds(t *testing.T) {
+	out := &signalWriter{written: make(chan struct{})}
+	firstRowWritten = out.written
+
+	fsys := fstest.MapFS{"first.txt": {Data: []byte("one two\n")}}
+	inputs := []wc.InputSource{
+		{Path: "first.txt", DisplayName: "first.txt", FS: fsys},
+		{Path: "after-first-row://x", DisplayName: "second", Scheme: "after-first-row"},
+	}
+
+	result, err := wc.RunTo(context.Background(), out, inputs, wc.RunOptions{Selection: wc.DefaultSelection(), TotalMode: wc.TotalAuto})
+	if err != nil {
+		t.Fatalf("RunTo failed: %v", err)
+	}
+	if result.HadErrors {
+		t.Fatalf("unexpected errors: %+v", result.Rows)
+	}
+
+	// A non-regular input sizes the columns to 7, as in GNU wc.
+	want := "      1       2       8 first.txt\n      1       1       5 second\n      2       3      13 total\n"
+	if out.String() != want {
+		t.Fatalf("output mismatch:\ngot  %q\nwant %q", out.String(), want)
+	}
+}
+
+func TestRunToSizesColumnsFromStat(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt": {Data: bytes.Repeat([]byte("word\n"), 30)},
+		"b.txt": {Data: []byte("x\n")},
+	}
+	inputs, err := wc.ResolveInputsFS(fsys, []string{"a.txt", "missing.txt", "b.txt"})
+	if err != nil {
+		t.Fatalf("ResolveInputsFS failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		inputs    []wc.InputSource
+		selection wc.CountSelection
+		want      string
+	}{
+		{name: "digits of the total size", inputs: inputs, selection: wc.DefaultSelection(), want: " 30  30 150 a.txt\n  1   1   2 b.txt\n 31  31 152 total\n"},
+		{name: "single count is padded too", inputs: inputs, selection: wc.CountSelection{Lines: true}, want: " 30 a.txt\n  1 b.txt\n 31 total\n"},
+		{name: "lone file with one count", inputs: inputs[:1], selection: wc.CountSelection{Lines: true}, want: "30 a.txt\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			if _, err := wc.RunTo(context.Background(), &out, test.inputs, wc.RunOptions{Selection: test.selection, TotalMode: wc.TotalAuto}); err != nil {
+				t.Fatalf("RunTo failed: %v", err)
+			}
+			if out.String() != test.want {
+				t.Fatalf("output mismatch:\ngot  %q\nwant %q", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestRunOnRowKeepsInputOrder(t *testing.T) {
+	fsys := fstest.MapFS{}
+	var inputs []wc.InputSource
+	for i, size := range []int{1, 10, 5000, 300, 2} {
+		path := fmt.Sprintf("file%d.txt", i)
+		fsys[path] = &fstest.MapFile{Data: bytes.Repeat([]byte("a\n"), size)}
+		inputs = append(inputs, wc.InputSource{Path: path, DisplayName: path, FS: fsys})
+	}
+
+	var seen []string
+	options := wc.RunOptions{Selection: wc.DefaultSelection(), Jobs: 3, OnRow: func(row wc.OutputRow) {
+		seen = append(seen, row.Name)
+	}}
+	result := wc.Run(inputs, options)
+
+	if len(seen) != len(result.Rows) {
+		t.Fatalf("OnRow saw %d rows, want %d", len(seen), len(result.Rows))
+	}
+	for i, row := range result.Rows {
+		if seen[i] != row.Name {
+			t.Fatalf("OnRow order mismatch at %d: got %s want %s", i, seen[i], row.Name)
+		}
+	}
+}
+
+func TestRunDedupe(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string]string{"a.txt": "one two\n", "b.txt": "three\n", "copy.txt": "one two\n"}
+	for name, data := range contents {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatalf("unable to write %s: %v", name, err)
+		}
+	}
+	names := []string{"b.txt", "a.txt", "copy.txt"}
+	if err := os.Link(filepath.Join(dir, "b.txt"), filepath.Join(dir, "link.txt")); err == nil {
+		names = append(names, "link.txt")
+	}
+
+	var paths []string
+	for _, name := range names {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	inputs, err := wc.ResolveInputs(paths, "")
+	if err != nil {
+		t.Fatalf("ResolveInputs failed: %v", err)
+	}
+
+	options := wc.RunOptions{Selection: wc.CountSelection{Lines: true, Words: true, Hash: "xxh64"}, TotalMode: wc.TotalAuto, Jobs: 4, Dedupe: true}
+	result := wc.Run(inputs, options)
+	wantDuplicateOf := []string{"", "", paths[1], paths[0]}
+	for i, row := range result.Rows {
+		if row.Error != nil || row.DuplicateOf != wantDuplicateOf[i] {
+			t.Fatalf("row %d: got %+v, want duplicate of %q", i, row, wantDuplicateOf[i])
+		}
+	}
+	if result.Total.Lines != 2 || result.Total.Words != 3 {
+		t.Fatalf("total must count each content once: got %+v", result.Total)
+	}
+
+	text, err := wc.Render(result, options)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	lines := strings.Split(text, "\n")
+	if want := "1 2 " + result.Rows[1].Counts.Hash + " " + paths[2] + " (duplicate of " + paths[1] + ")"; lines[2] != want {
+		t.Fatalf("duplicate row mismatch:\ngot  %q\nwant %q", lines[2], want)
+	}
+	if want := "2 3                  total"; lines[len(lines)-1] != want {
+		t.Fatalf("total row mismatch:\ngot  %q\nwant %q", lines[len(lines)-1], want)
+	}
+}
+
+// seekOnlyFile is a file whose contents can be reached only by ReadAt, so
+// counting it by reading fails.
+type seekOnlyFile struct {
+	*os.File
+}
+
+func (seekOnlyFile) Read([]byte) (int, error) {
+	return 0, errors.New("read the whole input")
+}
+
+func init() {
+	err := wc.RegisterOpener("seek-only", func(_ context.Context, target string) (io.ReadCloser, error) {
+		file, err := os.Open(strings.TrimPrefix(target, "seek-only://"))
+		if err != nil {
+			return nil, err
+		}
+		return seekOnlyFile{file}, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRunBinaryPolicyCountsBytesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("\x00\x01"), 5000), 0o644); err != nil {
+		t.Fatalf("unable to write input: %v", err)
+	}
+	inputs := []wc.InputSource{{Path: "seek-only://" + path, DisplayName: "image.bin", Scheme: "seek-only"}}
+
+	result := wc.Run(inputs, wc.RunOptions{Selection: wc.CountSelection{Bytes: true}, TotalMode: wc.TotalNever, Binary: wc.BinaryReport})
+	row := result.Rows[0]
+	if row.Error != nil || row.Counts.Bytes != 10000 || row.Status.String() != "binary" {
+		t.Fatalf("got %+v, want 10000 bytes reported as binary", row)
+	}
+}
+
+func TestRunBinaryPolicies(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte("plain text\n")},
+		"latin1":    {Data: []byte("caf\xe9 cr\xe8me br\xfbl\xe9e\n")},
+		"image.png": {Data: append([]byte("\x89PNG\r\n\x1a\n"), "IHDR pixels\n"...)},
+		"nul.bin":   {Data: []byte("one\x00two\nthree\n")},
+		"noise.bin": {Data: []byte("\xff\xfe\xfd\xfc\xfb\n")},
+	}
+	names := []string{"a.txt", "latin1", "image.png", "nul.bin", "noise.bin"}
+	var inputs []wc.InputSource
+	for _, name := range names {
+		inputs = append(inputs, wc.InputSource{Path: name, DisplayName: name, FS: fsys})
+	}
+
+	tests := []struct {
+		policy     wc.BinaryPolicy
+		wantStatus []string
+		wantLines  int
+	}{
+		{policy: wc.BinaryCount, wantStatus: []string{"", "", "", "", ""}, wantLines: 8},
+		{policy: wc.BinaryReport, wantStatus: []string{"", "", "binary", "binary", "binary"}, wantLines: 8},
+		{policy: wc.BinarySkip, wantStatus: []string{"", "", "skipped: binary", "skipped: binary", "skipped: binary"}, wantLines: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			options := wc.RunOptions{Selection: wc.CountSelection{Lines: true}, TotalMode: wc.TotalAuto, Binary: test.policy}
+			result := wc.Run(inputs, options)
+			for i, row := range result.Rows {
+				if row.Error != nil || row.Status.String() != test.wantStatus[i] {
+					t.Fatalf("row %s: got status %q error %v, want %q", row.Name, row.Status, row.Error, test.wantStatus[i])
+				}
+			}
+			if result.Total.Lines != test.wantLines || result.HadErrors {
+				t.Fatalf("total mismatch: got %+v (errors %v), want %d lines", result.Total, result.HadErrors, test.wantLines)
+			}
+		})
+	}
+
+	options := wc.RunOptions{Selection: wc.CountSelection{Lines: true}, TotalMode: wc.TotalAuto, Binary: wc.BinarySkip}
+	result := wc.Run(inputs[:3], options)
+	text, err := wc.Render(result, options)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if want := "1 a.txt\n1 latin1\n2 total"; text != want {
+		t.Fatalf("text output mismatch:\ngot  %q\nwant %q", text, want)
+	}
+
+	options.JSON = true
+	out, err := wc.Render(result, options)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if want := "{\n      \"file\": \"image.png\",\n      \"status\": \"skipped: binary\"\n    }"; !strings.Contains(out, want) {
+		t.Fatalf("JSON output is missing the skipped row:\n%s", out)
+	}
+}
@@ -0,0 +1,295 @@
+package wc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SliceUnit is what a Slice numbers.
+type SliceUnit string
+
+const (
+	SliceBytes SliceUnit = "bytes"
+	SliceLines SliceUnit = "lines"
+)
+
+// Slice selects the part of each input that is counted. Start and End number
+// the first and last byte or line counted, from 1; 0 leaves that end open.
+// With Last set, the last Start bytes or lines are counted instead, and End
+// must be open. Lines end at CountSelection.RecordDelimiter, and a last line
+// without one is a line. The zero Slice, with no Unit, counts everything,
+// while the last 0 lines select nothing.
+type Slice struct {
+	Unit  SliceUnit
+	Start int64
+	End   int64
+	Last  bool
+}
+
+// ParseSlice reads "START:END", where either side may be empty and START may
+// be -N for the last N. ":0" and "-0:" select nothing.
+func ParseSlice(unit SliceUnit, value string) (Slice, bool) {
+	first, last, found := strings.Cut(strings.TrimSpace(value), ":")
+	if !found {
+		return Slice{}, false
+	}
+
+	slice := Slice{Unit: unit}
+	var err error
+	if first != "" {
+		if slice.Start, err = strconv.ParseInt(first, 10, 64); err != nil {
+			return Slice{}, false
+		}
+		if slice.Last = strings.HasPrefix(first, "-"); slice.Last {
+			slice.Start = -slice.Start
+		}
+		if slice.Start < 0 || slice.Start == 0 && !slice.Last {
+			return Slice{}, false
+		}
+	}
+	if last != "" {
+		if slice.End, err = strconv.ParseInt(last, 10, 64); err != nil || slice.End < 0 {
+			return Slice{}, false
+		}
+		if slice.End == 0 {
+			if first != "" {
+				return Slice{}, false
+			}
+			return Slice{Unit: unit, Last: true}, true
+		}
+	}
+	if slice.Last && slice.End != 0 || slice.End != 0 && slice.End < slice.Start {
+		return Slice{}, false
+	}
+
+	return slice, true
+}
+
+// IsZero reports whether s counts the whole input.
+func (s Slice) IsZero() bool {
+	return s.Unit == ""
+}
+
+// String formats s the way ParseSlice reads it.
+func (s Slice) String() string {
+	var b strings.Builder
+	if s.Last {
+		b.WriteString("-" + strconv.FormatInt(s.Start, 10))
+	} else if s.Start != 0 {
+		b.WriteString(strconv.FormatInt(s.Start, 10))
+	}
+	b.WriteByte(':')
+	if s.End != 0 {
+		b.WriteString(strconv.FormatInt(s.End, 10))
+	}
+	return b.String()
+}
+
+// sliceInput returns a reader over the part of reader that slice selects,
+// with lines ending at delimiter. Regular files are positioned with ReadAt
+// from their current offset, so only the selected bytes, or for the last
+// lines only the blocks holding them, are read; other inputs are read through
+// and the rest discarded. Nothing is read when the slice selects nothing.
+func sliceInput(reader io.Reader, slice Slice, delimiter byte) (io.Reader, error) {
+	if slice.Last && slice.Start == 0 {
+		return bytes.NewReader(nil), nil
+	}
+	file, offset, size, seekable := regularFile(reader)
+
+	switch {
+	case slice.Unit == SliceBytes && slice.Last:
+		if seekable {
+			start := max(offset, size-slice.Start)
+			return newFileSection(file, start, size-start), nil
+		}
+		return tailStream(reader, func(data []byte) int { return max(0, len(data)-int(slice.Start)) })
+	case slice.Unit == SliceBytes:
+		skip := max(slice.Start-1, 0)
+		if seekable {
+			start := min(offset+skip, size)
+			length := size - start
+			if slice.End > 0 {
+				length = min(length, slice.End-skip)
+			}
+			return newFileSection(file, start, length), nil
+		}
+		if _, err := io.CopyN(io.Discard, reader, skip); err != nil && err != io.EOF {
+			return nil, err
+		}
+		if slice.End > 0 {
+			return io.LimitReader(reader, slice.End-skip), nil
+		}
+		return reader, nil
+	case slice.Last:
+		if seekable {
+			start, err := lastLinesOffset(file, offset, size, slice.Start, delimiter)
+			if err != nil {
+				return nil, err
+			}
+			return newFileSection(file, start, size-start), nil
+		}
+		return tailStream(reader, func(data []byte) int { return lastLines(data, slice.Start, delimiter) })
+	default:
+		return &lineRangeReader{reader: reader, delimiter: delimiter, line: 1, start: max(slice.Start, 1), end: slice.End}, nil
+	}
+}
+
+// fileSection is the part of a regular file a slice selects. It reads like
+// the io.SectionReader it embeds and keeps the file and offset, so byte counts
+// come from its size and other counts can map it.
+type fileSection struct {
+	*io.SectionReader
+	file   *os.File
+	offset int64
+}
+
+func newFileSection(file *os.File, offset int64, length int64) *fileSection {
+	return &fileSection{SectionReader: io.NewSectionReader(file, offset, length), file: file, offset: offset}
+}
+
+// regularFile reports the current offset and size of a regular file.
+func regularFile(reader io.Reader) (*os.File, int64, int64, bool) {
+	file, ok := reader.(*os.File)
+	if !ok {
+		return nil, 0, 0, false
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, 0, 0, false
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil || offset > info.Size() {
+		return nil, 0, 0, false
+	}
+
+	return file, offset, info.Size(), true
+}
+
+// tailStream reads reader to the end, keeping only what keep says to: keep
+// returns where the wanted tail of the data seen so far starts. The buffer
+// is trimmed whenever it has doubled, so memory stays proportional to the
+// tail.
+func tailStream(reader io.Reader, keep func(data []byte) int) (io.Reader, error) {
+	var data []byte
+	trimAt := countChunkSize
+	chunk := make([]byte, countChunkSize)
+	for {
+		n, err := reader.Read(chunk)
+		data = append(data, chunk[:n]...)
+		if len(data) >= trimAt {
+			data = append([]byte(nil), data[keep(data):]...)
+			trimAt = max(countChunkSize, 2*len(data))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bytes.NewReader(data[keep(data):]), nil
+}
+
+// lastLines returns where the last n lines of data start. A delimiter ending
+// data closes the last line rather than starting another.
+func lastLines(data []byte, n int64, delimiter byte) int {
+	end := len(data)
+	if end > 0 && data[end-1] == delimiter {
+		end--
+	}
+	for ; n > 0; n-- {
+		i := bytes.LastIndexByte(data[:end], delimiter)
+		if i < 0 {
+			return 0
+		}
+		if n == 1 {
+			return i + 1
+		}
+		end = i
+	}
+
+	return len(data)
+}
+
+// lastLinesOffset finds where the last n lines of file between offset and
+// size start, reading blocks backwards from the end.
+func lastLinesOffset(file *os.File, offset int64, size int64, n int64, delimiter byte) (int64, error) {
+	block := make([]byte, countChunkSize)
+	end := size
+	// The delimiter ending the file closes the last line.
+	skipFinal := true
+	for end > offset {
+		start := max(offset, end-int64(len(block)))
+		data := block[:end-start]
+		if _, err := file.ReadAt(data, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		if skipFinal {
+			skipFinal = false
+			if data[len(data)-1] == delimiter {
+				data = data[:len(data)-1]
+			}
+		}
+		for {
+			i := bytes.LastIndexByte(data, delimiter)
+			if i < 0 {
+				break
+			}
+			if n--; n == 0 {
+				return start + int64(i) + 1, nil
+			}
+			data = data[:i]
+		}
+		end = start
+	}
+
+	return offset, nil
+}
+
+// lineRangeReader passes on lines start through end, or to the end of the
+// input when end is 0, and stops reading once past end.
+type lineRangeReader struct {
+	reader    io.Reader
+	delimiter byte
+	// line numbers the line the next byte belongs to.
+	line  int64
+	start int64
+	end   int64
+}
+
+func (r *lineRangeReader) Read(p []byte) (int, error) {
+	for {
+		if r.end > 0 && r.line > r.end {
+			return 0, io.EOF
+		}
+		n, err := r.reader.Read(p)
+		if kept := r.filter(p[:n]); kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// filter moves the selected bytes of chunk, a prefix of the caller's buffer,
+// to its start.
+func (r *lineRangeReader) filter(chunk []byte) int {
+	kept := 0
+	for pos := 0; pos < len(chunk); {
+		next := len(chunk)
+		if i := bytes.IndexByte(chunk[pos:], r.delimiter); i >= 0 {
+			next = pos + i + 1
+		}
+		if r.line >= r.start && (r.end == 0 || r.line <= r.end) {
+			kept += copy(chunk[kept:], chunk[pos:next])
+		}
+		if chunk[next-1] == r.delimiter {
+			r.line++
+		}
+		pos = next
+	}
+
+	return kept
+}
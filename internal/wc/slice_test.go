@@ -0,0 +1,178 @@
+package wc_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"cc/wcx/internal/wc"
+)
+
+func TestParseSlice(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   wc.Slice
+		wantOK bool
+	}{
+		{value: "3:7", want: wc.Slice{Unit: wc.SliceLines, Start: 3, End: 7}, wantOK: true},
+		{value: "3:", want: wc.Slice{Unit: wc.SliceLines, Start: 3}, wantOK: true},
+		{value: ":7", want: wc.Slice{Unit: wc.SliceLines, End: 7}, wantOK: true},
+		{value: "5:5", want: wc.Slice{Unit: wc.SliceLines, Start: 5, End: 5}, wantOK: true},
+		{value: "-100:", want: wc.Slice{Unit: wc.SliceLines, Start: 100, Last: true}, wantOK: true},
+		{value: ":", want: wc.Slice{Unit: wc.SliceLines}, wantOK: true},
+		{value: "-0:", want: wc.Slice{Unit: wc.SliceLines, Last: true}, wantOK: true},
+		{value: ":0", want: wc.Slice{Unit: wc.SliceLines, Last: true}, wantOK: true},
+		{value: "7"},
+		{value: "0:7"},
+		{value: "0:"},
+		{value: "3:0"},
+		{value: "-0:3"},
+		{value: "7:3"},
+		{value: "-3:5"},
+		{value: "a:b"},
+	}
+
+	for _, test := range tests {
+		got, ok := wc.ParseSlice(wc.SliceLines, test.value)
+		if ok != test.wantOK || got != test.want {
+			t.Fatalf("ParseSlice(%q): got %+v, %v want %+v, %v", test.value, got, ok, test.want, test.wantOK)
+		}
+		if ok && test.value != ":" && test.value != ":0" && got.String() != test.value {
+			t.Fatalf("String() of %q: got %q", test.value, got.String())
+		}
+	}
+}
+
+// referenceSlice cuts data the slow way: by splitting it into lines.
+func referenceSlice(data []byte, slice wc.Slice) []byte {
+	var units [][]byte
+	if slice.Unit == wc.SliceBytes {
+		for i := range data {
+			units = append(units, data[i:i+1])
+		}
+	} else {
+		units = bytes.SplitAfter(data, []byte("\n"))
+		if len(units[len(units)-1]) == 0 {
+			units = units[:len(units)-1]
+		}
+	}
+
+	first, last := int64(0), int64(len(units))
+	switch {
+	case slice.Last:
+		first = max(0, last-slice.Start)
+	case slice.Start > 0:
+		first = min(slice.Start-1, last)
+	}
+	if slice.End > 0 {
+		last = max(first, min(slice.End, last))
+	}
+
+	return bytes.Join(units[first:last], nil)
+}
+
+func TestRunSlice(t *testing.T) {
+	// Enough data for the last-lines search to cross read blocks, with and
+	// without a final newline.
+	var builder strings.Builder
+	for i := 1; i <= 20000; i++ {
+		builder.WriteString(strings.Repeat("word ", i%7) + strconv.Itoa(i) + "\n")
+	}
+	terminated := builder.String()
+	inputs := map[string]string{"terminated.txt": terminated, "cut.txt": terminated + "tail end"}
+
+	dir := t.TempDir()
+	fsys := fstest.MapFS{}
+	for name, data := range inputs {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatalf("unable to write %s: %v", name, err)
+		}
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+
+	slices := []wc.Slice{
+		{Unit: wc.SliceLines, End: 10},
+		{Unit: wc.SliceLines, Start: 19990},
+		{Unit: wc.SliceLines, Start: 100, End: 15000},
+		{Unit: wc.SliceLines, Start: 30000},
+		{Unit: wc.SliceLines, Start: 1, Last: true},
+		{Unit: wc.SliceLines, Start: 12345, Last: true},
+		{Unit: wc.SliceLines, Start: 50000, Last: true},
+		{Unit: wc.SliceBytes, Start: 2, End: 70000},
+		{Unit: wc.SliceBytes, Start: 100000},
+		{Unit: wc.SliceBytes, Start: 70000, Last: true},
+		{Unit: wc.SliceBytes, Start: 1000000, Last: true},
+		{Unit: wc.SliceLines, Last: true},
+		{Unit: wc.SliceBytes, Last: true},
+	}
+	// Byte counts alone come from the bounds of a slice of a file on disk.
+	selections := []wc.CountSelection{{Lines: true, Words: true, Bytes: true}, {Bytes: true}}
+
+	for name, data := range inputs {
+		for _, slice := range slices {
+			for _, selection := range selections {
+				t.Run(name+"/"+string(slice.Unit)+slice.String(), func(t *testing.T) {
+					want, err := wc.CountReader(bytes.NewReader(referenceSlice([]byte(data), slice)), selection)
+					if err != nil {
+						t.Fatalf("CountReader failed: %v", err)
+					}
+
+					fsInputs, err := wc.ResolveInputsFS(fsys, []string{name})
+					if err != nil {
+						t.Fatalf("ResolveInputsFS failed: %v", err)
+					}
+					// Files on disk are positioned directly; fs.FS files are
+					// streamed.
+					for _, input := range append(fsInputs, wc.InputSource{Path: filepath.Join(dir, name), DisplayName: name}) {
+						for _, mode := range []wc.IOMode{wc.IORead, wc.IOMmap} {
+							result := wc.Run([]wc.InputSource{input}, wc.RunOptions{Selection: selection, TotalMode: wc.TotalNever, IO: mode, Slice: slice})
+							row := result.Rows[0]
+							if row.Error != nil {
+								t.Fatalf("%s: unexpected error: %v", mode, row.Error)
+							}
+							if !reflect.DeepEqual(row.Counts, want) {
+								t.Fatalf("%s %s: got %+v want %+v", input.Path, mode, row.Counts, want)
+							}
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestRunSliceRecords(t *testing.T) {
+	data := "a\x00b\nc\x00d\x00"
+	path := filepath.Join(t.TempDir(), "list")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("unable to write input: %v", err)
+	}
+	fsys := fstest.MapFS{"list": {Data: []byte(data)}}
+	fsInputs, err := wc.ResolveInputsFS(fsys, []string{"list"})
+	if err != nil {
+		t.Fatalf("ResolveInputsFS failed: %v", err)
+	}
+
+	selection := wc.CountSelection{Lines: true, Bytes: true, RecordDelimiter: "\x00"}
+	tests := []struct {
+		slice wc.Slice
+		want  wc.Counts
+	}{
+		{slice: wc.Slice{Unit: wc.SliceLines, End: 1}, want: wc.Counts{Lines: 1, Bytes: 2}},
+		{slice: wc.Slice{Unit: wc.SliceLines, Start: 2, End: 2}, want: wc.Counts{Lines: 1, Bytes: 4}},
+		{slice: wc.Slice{Unit: wc.SliceLines, Start: 2, Last: true}, want: wc.Counts{Lines: 2, Bytes: 6}},
+	}
+	for _, test := range tests {
+		for _, input := range append(fsInputs, wc.InputSource{Path: path, DisplayName: "list"}) {
+			result := wc.Run([]wc.InputSource{input}, wc.RunOptions{Selection: selection, TotalMode: wc.TotalNever, Slice: test.slice})
+			if got := result.Rows[0].Counts; !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("%s %s: got %+v want %+v", input.Path, test.slice, got, test.want)
+			}
+		}
+	}
+}
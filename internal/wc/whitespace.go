@@ -0,0 +1,141 @@
+package wc
+
+// whitespaceKind selects which whitespace statistic a metric reports.
+type whitespaceKind int
+
+const (
+	trailingWhitespace whitespaceKind = iota
+	tabIndented
+	spaceIndented
+	mixedIndented
+	maxIndent
+)
+
+// whitespaceMetric reports on the leading and trailing whitespace of lines.
+// Indentation is only classified on lines with content, and its depth is
+// measured in columns with the 8-column tab stops -L uses.
+type whitespaceMetric struct {
+	name      string
+	kind      whitespaceKind
+	delimiter byte
+}
+
+// WhitespaceMetrics returns the bundled whitespace hygiene metrics in report
+// order: trailingWhitespace, tabIndented, spaceIndented, mixedIndented, and
+// maxIndent. They are registered from the start, so --metric can select them
+// by name.
+func WhitespaceMetrics() []Metric {
+	return []Metric{
+		whitespaceMetric{name: "trailingWhitespace", kind: trailingWhitespace, delimiter: '\n'},
+		whitespaceMetric{name: "tabIndented", kind: tabIndented, delimiter: '\n'},
+		whitespaceMetric{name: "spaceIndented", kind: spaceIndented, delimiter: '\n'},
+		whitespaceMetric{name: "mixedIndented", kind: mixedIndented, delimiter: '\n'},
+		whitespaceMetric{name: "maxIndent", kind: maxIndent, delimiter: '\n'},
+	}
+}
+
+func (m whitespaceMetric) Name() string { return m.name }
+
+func (m whitespaceMetric) NewAccumulator() Accumulator {
+	return &whitespaceAccumulator{kind: m.kind, delimiter: rune(m.delimiter), line: 1, inIndent: true}
+}
+
+func (m whitespaceMetric) withDelimiter(delimiter byte) Metric {
+	m.delimiter = delimiter
+	return m
+}
+
+func (m whitespaceMetric) Merge(total int, value int) int {
+	if m.kind == maxIndent {
+		return max(total, value)
+	}
+	return sumMerge(total, value)
+}
+
+// whitespaceAccumulator follows one line at a time. Carriage returns are
+// ignored, so the CR of a CRLF ending neither hides nor counts as trailing
+// whitespace.
+type whitespaceAccumulator struct {
+	kind      whitespaceKind
+	delimiter rune
+
+	line       int
+	inIndent   bool
+	indent     int
+	sawTab     bool
+	sawSpace   bool
+	hasContent bool
+	lastBlank  bool
+
+	value    int
+	record   bool
+	findings []int
+}
+
+func (a *whitespaceAccumulator) AddRune(unit Unit) {
+	switch {
+	case unit.Rune == a.delimiter && !unit.Invalid:
+		a.endLine()
+		a.line++
+		a.inIndent, a.indent, a.sawTab, a.sawSpace, a.hasContent, a.lastBlank = true, 0, false, false, false, false
+	case unit.Rune == '\r' && !unit.Invalid:
+	case (unit.Rune == ' ' || unit.Rune == '\t') && !unit.Invalid:
+		if a.inIndent {
+			if unit.Rune == '\t' {
+				a.sawTab = true
+				a.indent += 8 - (a.indent % 8)
+			} else {
+				a.sawSpace = true
+				a.indent++
+			}
+		}
+		a.lastBlank = true
+	default:
+		a.inIndent = false
+		a.hasContent = true
+		a.lastBlank = false
+	}
+}
+
+func (a *whitespaceAccumulator) endLine() {
+	flagged := false
+	switch a.kind {
+	case trailingWhitespace:
+		flagged = a.lastBlank
+	case tabIndented:
+		flagged = a.hasContent && a.sawTab && !a.sawSpace
+	case spaceIndented:
+		flagged = a.hasContent && a.sawSpace && !a.sawTab
+	case mixedIndented:
+		flagged = a.hasContent && a.sawTab && a.sawSpace
+	case maxIndent:
+		if a.hasContent {
+			a.value = max(a.value, a.indent)
+		}
+		return
+	}
+
+	if flagged {
+		a.value++
+		if a.record {
+			a.findings = append(a.findings, a.line)
+		}
+	}
+}
+
+// current is the state with an unterminated last line closed.
+func (a *whitespaceAccumulator) current() whitespaceAccumulator {
+	closed := *a
+	closed.findings = append([]int(nil), a.findings...)
+	closed.endLine()
+	return closed
+}
+
+func (a *whitespaceAccumulator) Value() int { return a.current().value }
+
+// RecordFindings is only meaningful for the kinds that flag problems.
+func (a *whitespaceAccumulator) RecordFindings() {
+	a.record = a.kind == trailingWhitespace || a.kind == mixedIndented
+}
+
+func (a *whitespaceAccumulator) Findings() []int { return a.current().findings }
@@ -0,0 +1,87 @@
+package wc_test
+
+import (
+	"reflect"
+	"testing"
+
+	"cc/wcx/internal/wc"
+)
+
+func TestWhitespaceMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		want         map[string]int
+		wantFindings []wc.Finding
+	}{
+		{
+			name:  "clean",
+			input: "a\n\tb\n    c\n",
+			want:  map[string]int{"trailingWhitespace": 0, "tabIndented": 1, "spaceIndented": 1, "mixedIndented": 0, "maxIndent": 8},
+		},
+		{
+			name:  "trailing blanks and blank lines",
+			input: "a \n  \n\nb\t\r\nlast ",
+			want:  map[string]int{"trailingWhitespace": 4, "tabIndented": 0, "spaceIndented": 0, "mixedIndented": 0, "maxIndent": 0},
+			wantFindings: []wc.Finding{
+				{Line: 1, Metric: "trailingWhitespace"},
+				{Line: 2, Metric: "trailingWhitespace"},
+				{Line: 4, Metric: "trailingWhitespace"},
+				{Line: 5, Metric: "trailingWhitespace"},
+			},
+		},
+		{
+			name:  "mixed indentation uses tab stops",
+			input: "  \t  x \n\t\ty\n",
+			want:  map[string]int{"trailingWhitespace": 1, "tabIndented": 1, "spaceIndented": 0, "mixedIndented": 1, "maxIndent": 16},
+			wantFindings: []wc.Finding{
+				{Line: 1, Metric: "trailingWhitespace"},
+				{Line: 1, Metric: "mixedIndented"},
+			},
+		},
+	}
+
+	selection := wc.CountSelection{Extra: wc.WhitespaceMetrics(), Findings: true}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for split := 0; split <= len(test.input); split++ {
+				counter := wc.NewCounter(selection)
+				_, _ = counter.Write([]byte(test.input[:split]))
+				_, _ = counter.Write([]byte(test.input[split:]))
+				_ = counter.Close()
+
+				counts := counter.Counts()
+				if !reflect.DeepEqual(counts.Extra, test.want) {
+					t.Fatalf("split at %d: got %v want %v", split, counts.Extra, test.want)
+				}
+				if !reflect.DeepEqual(counts.Findings, test.wantFindings) {
+					t.Fatalf("split at %d: findings %v want %v", split, counts.Findings, test.wantFindings)
+				}
+			}
+		})
+	}
+}
+
+func TestWhitespaceMetricsAreRegistered(t *testing.T) {
+	for _, metric := range wc.WhitespaceMetrics() {
+		if _, ok := wc.LookupMetric(metric.Name()); !ok {
+			t.Fatalf("%s is not registered", metric.Name())
+		}
+		if err := wc.RegisterMetric(metric); err == nil {
+			t.Fatalf("registering %s twice must fail", metric.Name())
+		}
+	}
+}
+
+func TestRenderFindings(t *testing.T) {
+	selection := wc.CountSelection{Lines: true, Extra: wc.WhitespaceMetrics()[:1], Findings: true}
+	rows := []wc.OutputRow{{Name: "a.txt", Counts: wc.Counts{
+		Lines:    2,
+		Extra:    map[string]int{"trailingWhitespace": 1},
+		Findings: []wc.Finding{{Line: 1, Metric: "trailingWhitespace"}},
+	}}}
+
+	if got, want := wc.FormatTextRows(rows, selection), "a.txt:1: trailingWhitespace\n2 1 a.txt"; got != want {
+		t.Fatalf("text output mismatch:\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -1,15 +1,54 @@
 package wc
 
-import core "cc/wcx/internal/wc"
+import (
+	"context"
+	"io"
+	"io/fs"
+	"regexp"
+
+	core "cc/wcx/internal/wc"
+)
 
 type (
 	Counts         = core.Counts
 	CountSelection = core.CountSelection
+	Counter        = core.Counter
 	InputSource    = core.InputSource
+	ResolveOptions = core.ResolveOptions
+	IOMode         = core.IOMode
 	OutputRow      = core.OutputRow
+	RowStatus      = core.RowStatus
+	BinaryPolicy   = core.BinaryPolicy
+	EOLStats       = core.EOLStats
+	LineEnding     = core.LineEnding
+	EncodingReport = core.EncodingReport
+	EncodingError  = core.EncodingError
+	Breakdown      = core.Breakdown
+	Slice          = core.Slice
+	SliceUnit      = core.SliceUnit
 	RunOptions     = core.RunOptions
 	RunResult      = core.RunResult
 	TotalMode      = core.TotalMode
+
+	Metric             = core.Metric
+	Accumulator        = core.Accumulator
+	RuneAccumulator    = core.RuneAccumulator
+	ChunkAccumulator   = core.ChunkAccumulator
+	FindingAccumulator = core.FindingAccumulator
+	Finding            = core.Finding
+	MatchMetric        = core.MatchMetric
+	MatchUnit          = core.MatchUnit
+	Unit               = core.Unit
+
+	Opener = core.Opener
+
+	Formatter        = core.Formatter
+	Layout           = core.Layout
+	Summary          = core.Summary
+	NewFormatterFunc = core.NewFormatterFunc
+
+	Cache      = core.Cache
+	CacheStats = core.CacheStats
 )
 
 const (
@@ -19,6 +58,80 @@ const (
 	TotalNever  = core.TotalNever
 )
 
+const (
+	BinaryCount  = core.BinaryCount
+	BinarySkip   = core.BinarySkip
+	BinaryReport = core.BinaryReport
+)
+
+const (
+	EOLLF   = core.EOLLF
+	EOLCRLF = core.EOLCRLF
+)
+
+const (
+	BreakdownScript   = core.BreakdownScript
+	BreakdownCategory = core.BreakdownCategory
+)
+
+const (
+	SliceBytes = core.SliceBytes
+	SliceLines = core.SliceLines
+)
+
+const (
+	MatchLines       = core.MatchLines
+	MatchOccurrences = core.MatchOccurrences
+)
+
+const (
+	IOAuto = core.IOAuto
+	IORead = core.IORead
+	IOMmap = core.IOMmap
+)
+
+// NewCounter returns a Counter for data that arrives in chunks, for example
+// an upload being streamed elsewhere through an io.MultiWriter.
+func NewCounter(selection CountSelection) *Counter {
+	return core.NewCounter(selection)
+}
+
+// CountReader counts everything reader yields until EOF.
+func CountReader(reader io.Reader, selection CountSelection) (Counts, error) {
+	return core.CountReader(reader, selection)
+}
+
+// CountReaderContext is CountReader that stops once ctx is done.
+func CountReaderContext(ctx context.Context, reader io.Reader, selection CountSelection) (Counts, error) {
+	return core.CountReaderContext(ctx, reader, selection)
+}
+
+// CountBytes counts an in-memory buffer.
+func CountBytes(data []byte, selection CountSelection) Counts {
+	counter := core.NewCounter(selection)
+	_, _ = counter.Write(data)
+	_ = counter.Close()
+	return counter.Counts()
+}
+
+// RegisterMetric makes a custom metric selectable by name, including through
+// the --metric option of a binary that registers it before parsing
+// arguments. Library callers can also put the Metric in CountSelection.Extra
+// directly without registering it.
+func RegisterMetric(m Metric) error {
+	return core.RegisterMetric(m)
+}
+
+// NewMatchMetric returns a metric called name that counts pattern over the
+// lines of the input, per matching line or per match.
+func NewMatchMetric(name string, pattern *regexp.Regexp, unit MatchUnit) *MatchMetric {
+	return core.NewMatchMetric(name, pattern, unit)
+}
+
+func LookupMetric(name string) (Metric, bool) {
+	return core.LookupMetric(name)
+}
+
 func DefaultSelection() CountSelection {
 	return core.DefaultSelection()
 }
@@ -31,14 +144,134 @@ func ParseTotalMode(value string) (TotalMode, bool) {
 	return core.ParseTotalMode(value)
 }
 
+func ParseIOMode(value string) (IOMode, bool) {
+	return core.ParseIOMode(value)
+}
+
+func ParseLineEnding(value string) (LineEnding, bool) {
+	return core.ParseLineEnding(value)
+}
+
+func ParseBinaryPolicy(value string) (BinaryPolicy, bool) {
+	return core.ParseBinaryPolicy(value)
+}
+
+func ParseBreakdown(value string) (Breakdown, bool) {
+	return core.ParseBreakdown(value)
+}
+
+func ParseSlice(unit SliceUnit, value string) (Slice, bool) {
+	return core.ParseSlice(unit, value)
+}
+
+func ParseRecordDelimiter(value string) (string, bool) {
+	return core.ParseRecordDelimiter(value)
+}
+
 func ResolveInputs(args []string, files0From string) ([]InputSource, error) {
 	return core.ResolveInputs(args, files0From)
 }
 
+// ResolveInputsOptions is ResolveInputs with options. Names read from
+// ResolveOptions.Files0From are paths unless Files0Schemes is set.
+func ResolveInputsOptions(args []string, options ResolveOptions) ([]InputSource, error) {
+	return core.ResolveInputsOptions(args, options)
+}
+
+// ResolveInputsFS expands patterns against fsys, such as an embed.FS, a
+// *zip.Reader, or an fstest.MapFS. Matched directories are walked
+// recursively. The returned inputs can be passed to Run and RunContext.
+func ResolveInputsFS(fsys fs.FS, patterns []string) ([]InputSource, error) {
+	return core.ResolveInputsFS(fsys, patterns)
+}
+
+// RegisterOpener routes operands of the form "scheme://..." to opener, for
+// example to count objects in a blob store. file, http, https, and fd are
+// built in.
+func RegisterOpener(scheme string, opener Opener) error {
+	return core.RegisterOpener(scheme, opener)
+}
+
+// OpenCommand counts the output of a shell command. Register it, usually as
+// exec, only when the operands are trusted.
+func OpenCommand(ctx context.Context, target string) (io.ReadCloser, error) {
+	return core.OpenCommand(ctx, target)
+}
+
+func LookupOpener(scheme string) (Opener, bool) {
+	return core.LookupOpener(scheme)
+}
+
+func ExcludeInputs(inputs []InputSource, patterns []string) []InputSource {
+	return core.ExcludeInputs(inputs, patterns)
+}
+
 func Run(inputs []InputSource, options RunOptions) RunResult {
 	return core.Run(inputs, options)
 }
 
+func RunContext(ctx context.Context, inputs []InputSource, options RunOptions) RunResult {
+	return core.RunContext(ctx, inputs, options)
+}
+
+// RunFS counts the files in fsys matched by patterns, with the same row and
+// total semantics as Run.
+func RunFS(fsys fs.FS, patterns []string, options RunOptions) (RunResult, error) {
+	return RunFSContext(context.Background(), fsys, patterns, options)
+}
+
+func RunFSContext(ctx context.Context, fsys fs.FS, patterns []string, options RunOptions) (RunResult, error) {
+	inputs, err := core.ResolveInputsFS(fsys, patterns)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	return core.RunContext(ctx, inputs, options), nil
+}
+
+// RunTo counts inputs and writes each row to w as soon as it and every row
+// before it are done, returning the same result as RunContext.
+func RunTo(ctx context.Context, w io.Writer, inputs []InputSource, options RunOptions) (RunResult, error) {
+	return core.RunTo(ctx, w, inputs, options)
+}
+
 func Render(result RunResult, options RunOptions) (string, error) {
 	return core.Render(result, options)
 }
+
+// RenderTo streams the output of Render to w, newline-terminated, without
+// building it in memory first.
+func RenderTo(w io.Writer, result RunResult, options RunOptions) error {
+	return core.RenderTo(w, result, options)
+}
+
+// RegisterFormatter adds an output format selectable with RunOptions.Format
+// and --format. "text" and "json" are built in.
+func RegisterFormatter(name string, create NewFormatterFunc) error {
+	return core.RegisterFormatter(name, create)
+}
+
+func LookupFormatter(name string) (NewFormatterFunc, bool) {
+	return core.LookupFormatter(name)
+}
+
+func FormatterNames() []string {
+	return core.FormatterNames()
+}
+
+// OpenCache loads the count cache at path for RunOptions.Cache; a missing or
+// outdated file starts an empty cache. Call Save after the run to keep it.
+func OpenCache(path string) (*Cache, error) {
+	return core.OpenCache(path)
+}
+
+// HashNames lists the content hashes CountSelection.Hash accepts.
+func HashNames() []string {
+	return core.HashNames()
+}
+
+// WhitespaceMetrics returns the bundled whitespace hygiene metrics, ready for
+// CountSelection.Extra.
+func WhitespaceMetrics() []Metric {
+	return core.WhitespaceMetrics()
+}